@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jmyounker/spunge/pkg/sponge"
+	"github.com/urfave/cli"
+)
+
+// casConflicts make no sense when the destination is named by its
+// contents, so that there is nothing to back up, compare, or append to.
+var casConflicts = []string{
+	"backup", "backup-numbered", "backup-dir", "backup-keep", "journal",
+	"atomic", "memory", "max-memory", "memfd", "reference", "owner", "group",
+	"preserve", "preserve-times", "append", "direct", "backend", "sparse",
+	"dry-run", "diff", "confirm", "skip-unchanged", "checksum", "tee",
+	"post-cmd", "lock", "lock-file", "lock-dir",
+	"lock-stale", "lock-timeout", "if-unmodified", "expect-sha256",
+	"no-clobber", "exchange", "in-place", "follow-symlinks",
+	"replace-symlink", "no-follow", "parents", "parents-mode",
+	"delete-if-empty", "check-space", "fallback-target",
+}
+
+// SpongeCAS stores the input in the content-addressable directory given
+// by --cas, and prints where it was stored.
+func SpongeCAS(ctx context.Context, c *cli.Context, r *Report) error {
+	dir := c.GlobalString("cas")
+	if len(c.Args()) > 0 {
+		return errors.New("--cas names the destination, so it makes no sense with DEST")
+	}
+	if err := RefuseFlags(c, casConflicts, "--cas"); err != nil {
+		return err
+	}
+	if c.GlobalString("report-json") == "-" {
+		return errors.New("--report-json - makes no sense with --cas")
+	}
+	if err := SetBufferSize(c, []string{dir}); err != nil {
+		return err
+	}
+	opts := GetOptions(c)
+	cs := sponge.NewCASSponge(dir, opts)
+	sf, err := DecorateSponge(c, dir, cs, opts)
+	if err != nil {
+		return err
+	}
+	in, err := OpenInput(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r.Stage = "begin"
+	if err := sf.Begin(ctx); err != nil {
+		return err
+	}
+	defer sf.Cleanup()
+	r.Stage = "transfer"
+	Notify("READY=1", "STATUS=Reading input for "+dir)
+	if err := TransferInput(ctx, c, in, sf); err != nil {
+		sf.Abort()
+		return err
+	}
+	r.Stage = "commit"
+	if err := sf.Complete(ctx); err != nil {
+		return err
+	}
+	r.committed = true
+	fmt.Println(cs.ObjectFn)
+	return nil
+}
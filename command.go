@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/jmyounker/spunge/pkg/sponge"
+)
+
+// ShellCommand builds a shell command from template, replacing each {}
+// with the quoted filename fn.  If the template has no {} then fn is
+// appended as the final argument.
+func ShellCommand(ctx context.Context, template, fn string) *exec.Cmd {
+	quoted := ShellQuote(fn)
+	var script string
+	if strings.Contains(template, "{}") {
+		script = strings.Replace(template, "{}", quoted, -1)
+	} else {
+		script = template + " " + quoted
+	}
+	cmd := exec.CommandContext(ctx, Shell[0], append(Shell[1:], script)...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// VerifyCommand returns a verification hook which runs template against
+// the scratch file, failing unless it exits successfully.
+func VerifyCommand(template string) func(ctx context.Context, fn string) error {
+	return func(ctx context.Context, fn string) error {
+		if err := ShellCommand(ctx, template, fn).Run(); err != nil {
+			return fmt.Errorf("Verification command failed: %s", err)
+		}
+		return nil
+	}
+}
+
+// RunPostCommand runs template for each target whose sponge changed it.
+func RunPostCommand(ctx context.Context, template string, targets []string, sponges []sponge.SpongeFile) error {
+	for i, target := range targets {
+		if ch, ok := sponges[i].(sponge.Changer); ok && !ch.Changed() {
+			continue
+		}
+		if err := ShellCommand(ctx, template, target).Run(); err != nil {
+			return fmt.Errorf("Post-commit command failed for %s: %s", target, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io"
+)
+
+// concatInput reads several inputs one after another, like cat.  Each is
+// only opened once the one before it is used up.
+type concatInput struct {
+	names []string
+	open  func(name string) (io.ReadCloser, error)
+	cur   io.ReadCloser
+}
+
+func (ci *concatInput) Read(p []byte) (int, error) {
+	for {
+		if ci.cur == nil {
+			if len(ci.names) == 0 {
+				return 0, io.EOF
+			}
+			r, err := ci.open(ci.names[0])
+			if err != nil {
+				return 0, err
+			}
+			ci.cur = r
+			ci.names = ci.names[1:]
+		}
+		n, err := ci.cur.Read(p)
+		if err == io.EOF {
+			ci.cur.Close()
+			ci.cur = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (ci *concatInput) Close() error {
+	if ci.cur == nil {
+		return nil
+	}
+	err := ci.cur.Close()
+	ci.cur = nil
+	return err
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/urfave/cli"
+)
+
+// SystemConfigFn holds site-wide defaults.
+var SystemConfigFn = "/etc/spunge.conf"
+
+// ConfigFiles lists the configuration files to read, lowest precedence
+// first.  --config replaces them all.
+func ConfigFiles(c *cli.Context) ([]string, error) {
+	if c.GlobalString("config") != "" {
+		return []string{c.GlobalString("config")}, nil
+	}
+	files := []string{SystemConfigFn}
+	configDir, err := os.UserConfigDir()
+	if err == nil {
+		files = append(files, filepath.Join(configDir, "spunge", "config.toml"))
+	}
+	return files, nil
+}
+
+// LoadConfig sets any global flags not given on the command line from
+// the configuration files.  Settings are named after the long flags.
+func LoadConfig(c *cli.Context) error {
+	files, err := ConfigFiles(c)
+	if err != nil {
+		return err
+	}
+	settings := map[string]interface{}{}
+	source := map[string]string{}
+	for _, fn := range files {
+		fileSettings := map[string]interface{}{}
+		_, err := toml.DecodeFile(fn, &fileSettings)
+		if os.IsNotExist(err) && !c.GlobalIsSet("config") {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("Cannot read config %s: %s", fn, err)
+		}
+		for name, value := range fileSettings {
+			settings[name] = value
+			source[name] = fn
+		}
+	}
+	known := map[string]bool{}
+	for _, f := range c.App.Flags {
+		known[strings.TrimSpace(strings.Split(f.GetName(), ",")[0])] = true
+	}
+	names := []string{}
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !known[name] || name == "config" {
+			return fmt.Errorf("Unknown setting %s in %s.", name, source[name])
+		}
+		if c.GlobalIsSet(name) {
+			continue
+		}
+		if err := setFlag(c, name, settings[name]); err != nil {
+			return fmt.Errorf("Bad setting %s in %s: %s", name, source[name], err)
+		}
+	}
+	return nil
+}
+
+// Lists set repeatable flags once per element.
+func setFlag(c *cli.Context, name string, value interface{}) error {
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+	for _, v := range values {
+		if err := c.GlobalSet(name, fmt.Sprint(v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
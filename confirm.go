@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TTY is where confirmation prompts are asked, since stdin carries the
+// data.
+var TTY = "/dev/tty"
+
+// ErrNotConfirmed stops a commit which the user declined.
+var ErrNotConfirmed = errors.New("Not confirmed, destination left unchanged.")
+
+// ConfirmHook returns a verification hook which asks on the terminal
+// before the scratch file replaces target.
+func ConfirmHook(target string) func(ctx context.Context, fn string) error {
+	return func(ctx context.Context, fn string) error {
+		fi, err := os.Stat(fn)
+		if err != nil {
+			return err
+		}
+		question := fmt.Sprintf("Create %s (%d bytes)?", target, fi.Size())
+		if tfi, err := os.Stat(target); err == nil {
+			delta := fi.Size() - tfi.Size()
+			question = fmt.Sprintf("Replace %s (%d -> %d bytes, %+d)?", target, tfi.Size(), fi.Size(), delta)
+		}
+		yes, err := Ask(question)
+		if err != nil {
+			return err
+		}
+		if !yes {
+			return ErrNotConfirmed
+		}
+		return nil
+	}
+}
+
+// Ask puts a yes or no question on the terminal.  Anything but yes is no.
+func Ask(question string) (bool, error) {
+	tty, err := os.OpenFile(TTY, os.O_RDWR, 0)
+	if err != nil {
+		return false, fmt.Errorf("Cannot confirm without a terminal: %s", err)
+	}
+	defer tty.Close()
+	if _, err := fmt.Fprintf(tty, "%s [y/N] ", question); err != nil {
+		return false, err
+	}
+	answer, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// VerifyHooks combines verification hooks, skipping nil ones, into one
+// which runs them in order until one fails.
+func VerifyHooks(hooks ...func(ctx context.Context, fn string) error) func(ctx context.Context, fn string) error {
+	active := []func(ctx context.Context, fn string) error{}
+	for _, hook := range hooks {
+		if hook != nil {
+			active = append(active, hook)
+		}
+	}
+	if len(active) == 0 {
+		return nil
+	}
+	return func(ctx context.Context, fn string) error {
+		for _, hook := range active {
+			if err := hook(ctx, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// DiffContext is the number of unchanged lines shown around each change.
+var DiffContext = 3
+
+// WriteDiff writes a unified diff from old to new, the before and after
+// contents of target, to w.  Binary contents are only reported as
+// differing.
+func WriteDiff(w io.Writer, target string, old, new []byte) error {
+	if bytes.Equal(old, new) {
+		return nil
+	}
+	if bytes.IndexByte(old, 0) >= 0 || bytes.IndexByte(new, 0) >= 0 {
+		_, err := fmt.Fprintf(w, "Binary contents of %s differ\n", target)
+		return err
+	}
+	return difflib.WriteUnifiedDiff(w, difflib.UnifiedDiff{
+		A:        splitLines(old),
+		B:        splitLines(new),
+		FromFile: target,
+		ToFile:   target,
+		Context:  DiffContext,
+	})
+}
+
+// Each line keeps its newline, so one is added to an unterminated last
+// line.
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n"
+	return lines
+}
+
+// ReadTarget returns target's contents, which are empty if it does not
+// exist.
+func ReadTarget(target string) ([]byte, error) {
+	data, err := ioutil.ReadFile(target)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// DiffHook returns a verification hook which prints the diff from target
+// to the scratch file on stderr.
+func DiffHook(target string) func(ctx context.Context, fn string) error {
+	return func(ctx context.Context, fn string) error {
+		old, err := ReadTarget(target)
+		if err != nil {
+			return err
+		}
+		new, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return err
+		}
+		return WriteDiff(os.Stderr, target, old, new)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jmyounker/spunge/pkg/sponge"
+	"github.com/urfave/cli"
+)
+
+// DryRun reads the input as Sponge would, and reports what committing it
+// would do to each destination without changing anything.
+func DryRun(ctx context.Context, c *cli.Context) error {
+	bf, err := GetBackup(c)
+	if err != nil {
+		return err
+	}
+	opts := GetOptions(c)
+	plans := []*sponge.DryRunSponge{}
+	sponges := []sponge.SpongeFile{}
+	for _, target := range Targets(c) {
+		plan := sponge.NewDryRunSponge(target, opts)
+		sf, err := DecorateSponge(c, target, plan, opts)
+		if err != nil {
+			return err
+		}
+		plans = append(plans, plan)
+		sponges = append(sponges, sf)
+	}
+	sf := sponge.NewMultiSponge(sponges...)
+	in, err := OpenInput(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := sf.Begin(ctx); err != nil {
+		return err
+	}
+	defer sf.Cleanup()
+	if err := TransferInput(ctx, c, in, sf); err != nil {
+		sf.Abort()
+		return err
+	}
+	if err := sf.Complete(ctx); err != nil {
+		return err
+	}
+	backups := TargetBackups(bf, len(Targets(c)))
+	changed := false
+	for i, plan := range plans {
+		changed = changed || plan.Differs
+		backupFn, err := PlannedBackup(backups[i], plan)
+		if err != nil {
+			return err
+		}
+		fmt.Println(DescribePlan(plan, backupFn))
+		if c.GlobalBool("diff") {
+			if err := DiffPlan(plan); err != nil {
+				return err
+			}
+		}
+	}
+	if c.GlobalBool("skip-unchanged") && !changed {
+		return cli.NewExitError("Destination unchanged.", ExitUnchanged)
+	}
+	return nil
+}
+
+// PlannedBackup returns where the backup of plan's target would go, or
+// "" if there would be none.
+func PlannedBackup(bf sponge.Backup, plan *sponge.DryRunSponge) (string, error) {
+	cb, ok := bf.(*sponge.ConcurrentBackup)
+	if !ok || !plan.Exists {
+		return "", nil
+	}
+	if cb.Numbered {
+		return sponge.NextNumberedBackup(cb.BackupFn)
+	}
+	return cb.BackupFn, nil
+}
+
+// DescribePlan summarizes a dry run for one destination on one line.
+func DescribePlan(plan *sponge.DryRunSponge, backupFn string) string {
+	action := "unchanged"
+	if !plan.Exists {
+		action = "create"
+	} else if plan.Differs {
+		action = "change"
+	}
+	s := fmt.Sprintf("%s: %s, %d bytes, mode %04o", plan.TargetFn, action, plan.Size, plan.Mode.Perm())
+	if backupFn != "" {
+		s += ", backup " + backupFn
+	}
+	return s
+}
+
+// DiffPlan prints the diff a dry run would make to its target on stderr.
+func DiffPlan(plan *sponge.DryRunSponge) error {
+	old, err := ReadTarget(plan.TargetFn)
+	if err != nil {
+		return err
+	}
+	new := plan.Data
+	if plan.Append {
+		new = append(append([]byte{}, old...), plan.Data...)
+	}
+	return WriteDiff(os.Stderr, plan.TargetFn, old, new)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/jmyounker/spunge/pkg/sponge"
+	"github.com/urfave/cli"
+)
+
+// DefaultJobs is how many files each filters at once by default.
+var DefaultJobs = runtime.NumCPU()
+
+// eachConflicts make no sense when filtering many files at once, each
+// being both the input and the destination.
+var eachConflicts = []string{
+	"input", "input-fd", "input-checksum", "exec", "output-fd", "exec-output",
+	"cas", "append", "dry-run", "confirm", "tee", "report-json",
+	"metrics-push", "progress", "stats", "diff", "expect-sha256", "no-clobber",
+	"name", "no-empty", "delete-if-empty", "min-bytes", "max-bytes",
+	"idle-timeout", "timeout",
+}
+
+// EachAction filters each of the files given as arguments, by
+// --files-from, or by --glob and --recursive through the --exec command,
+// several at a time.
+func EachAction(c *cli.Context) error {
+	script := c.String("exec")
+	if script == "" {
+		return errors.New("Each requires --exec.")
+	}
+	if c.Bool("null") && c.String("files-from") == "" {
+		return errors.New("--null makes no sense without --files-from")
+	}
+	targets := []string(c.Args())
+	if c.String("files-from") != "" {
+		listed, err := ReadFileList(c.String("files-from"), c.Bool("null"))
+		if err != nil {
+			return err
+		}
+		targets = append(targets, listed...)
+	}
+	selected, err := SelectFiles(c)
+	if err != nil {
+		return err
+	}
+	// Overlapping selections each name a file once.
+	chosen := map[string]bool{}
+	for _, target := range targets {
+		chosen[target] = true
+	}
+	for _, fn := range selected {
+		if !chosen[fn] {
+			chosen[fn] = true
+			targets = append(targets, fn)
+		}
+	}
+	if len(targets) == 0 {
+		return errors.New("Each requires files to filter.")
+	}
+	jobs := c.Int("jobs")
+	if jobs <= 0 {
+		return errors.New("--jobs must be positive")
+	}
+	if err := RefuseFlags(c, eachConflicts, "each"); err != nil {
+		return err
+	}
+	if err := CheckLock(c); err != nil {
+		return err
+	}
+	if err := SetRenameRetries(c); err != nil {
+		return err
+	}
+	if err := CheckEachTargets(c, targets); err != nil {
+		return err
+	}
+	if err := SetBufferSize(c, targets); err != nil {
+		return err
+	}
+	ctx, caught := SignalContext(context.Background())
+	failed := FilterFiles(ctx, c, script, targets, jobs)
+	if sig := caught(); sig != nil {
+		return cli.NewExitError(fmt.Sprintf("Interrupted by %s.", sig), SignalExitCode(sig))
+	}
+	if c.GlobalInt("backup-keep") > 0 {
+		if err := PruneBackups(c, targets); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed.", failed, len(targets))
+	}
+	return nil
+}
+
+// ReadFileList reads the names of files from fn, or stdin if fn is -.
+// Names are on separate lines, or with null are ended by NUL bytes, as
+// from find -print0.  Empty names are skipped.
+func ReadFileList(fn string, null bool) ([]string, error) {
+	var data []byte
+	var err error
+	if fn == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(fn)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sep := "\n"
+	if null {
+		sep = "\x00"
+	}
+	names := []string{}
+	for _, name := range strings.Split(string(data), sep) {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// CheckEachTargets checks that targets are distinct local files, whose
+// backups would not overwrite each other.
+func CheckEachTargets(c *cli.Context, targets []string) error {
+	seen := map[string]bool{}
+	backupFns := map[string]string{}
+	for _, target := range targets {
+		if _, _, ok := sponge.SplitMember(target); ok || sponge.IsRemote(target) || target == sponge.StdoutTarget {
+			return fmt.Errorf("Each can only filter local files, not %s.", target)
+		}
+		if seen[target] {
+			return fmt.Errorf("Each was given %s twice.", target)
+		}
+		seen[target] = true
+		bf, err := GetTargetBackup(c, target)
+		if err != nil {
+			return err
+		}
+		cb, ok := bf.(*sponge.ConcurrentBackup)
+		if !ok || c.GlobalBool("backup-numbered") {
+			continue
+		}
+		if other, ok := backupFns[cb.BackupFn]; ok {
+			return fmt.Errorf("Backups of %s and %s would both go to %s.", other, target, cb.BackupFn)
+		}
+		backupFns[cb.BackupFn] = target
+	}
+	return nil
+}
+
+// FilterFiles filters each of targets through script, running up to jobs
+// at once.  It reports each file's outcome, and returns how many failed.
+func FilterFiles(ctx context.Context, c *cli.Context, script string, targets []string, jobs int) int {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := 0
+	queue := make(chan string)
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range queue {
+				changed, err := FilterFile(ctx, c, script, target)
+				mu.Lock()
+				switch {
+				case err != nil:
+					failed++
+					fmt.Fprintf(os.Stderr, "%s: %s\n", target, err)
+				case changed:
+					fmt.Printf("%s: changed\n", target)
+				default:
+					fmt.Printf("%s: unchanged\n", target)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, target := range targets {
+		queue <- target
+	}
+	close(queue)
+	wg.Wait()
+	return failed
+}
+
+// FilterFile replaces target with the output of script, run with target
+// on its stdin, backing it up and checking it as for any destination.
+// It reports whether target changed.
+func FilterFile(ctx context.Context, c *cli.Context, script, target string) (bool, error) {
+	unlock, err := LockTargets(ctx, c, []string{target})
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	bf, err := GetTargetBackup(c, target)
+	if err != nil {
+		return false, err
+	}
+	sf, err := GetTargetSpongeFile(c, target)
+	if err != nil {
+		return false, err
+	}
+	in, err := OpenFilterInput(ctx, script, target)
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+	if err := bf.Begin(ctx); err != nil {
+		return false, err
+	}
+	if err := sf.Begin(ctx); err != nil {
+		bf.Abort()
+		return false, err
+	}
+	defer sf.Cleanup()
+	if err := sponge.Transfer(ctx, in, sf); err != nil {
+		bf.Abort()
+		sf.Abort()
+		return false, err
+	}
+	if err := bf.Complete(); err != nil {
+		sf.Abort()
+		return false, err
+	}
+	if err := sf.Complete(ctx); err != nil {
+		return false, err
+	}
+	changed := true
+	if ch, ok := sf.(sponge.Changer); ok {
+		changed = ch.Changed()
+	}
+	if Journaling(c) {
+		if err := JournalCommits(c, []string{target}, []bool{true}, bf, sf); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot write journal: %s\n", err)
+		}
+	}
+	if c.GlobalString("post-cmd") != "" {
+		err := RunPostCommand(ctx, c.GlobalString("post-cmd"), []string{target}, []sponge.SpongeFile{sf})
+		if err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// GetTargetBackup returns the backup for target alone.
+func GetTargetBackup(c *cli.Context, target string) (sponge.Backup, error) {
+	template := BackupTemplate(c)
+	if template == "" {
+		return &sponge.NoBackup{}, nil
+	}
+	return sponge.NewBackup(target, template, GetBackupOptions(c))
+}
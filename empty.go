@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/jmyounker/spunge/pkg/sponge"
+	"github.com/urfave/cli"
+)
+
+// ErrEmptyInput is returned by OpenInput when --no-empty or
+// --delete-if-empty is given and the input has no data.
+var ErrEmptyInput = errors.New("Input is empty, so the destination was left alone.")
+
+// deleteConflicts make no sense with --delete-if-empty, which removes
+// the destinations rather than replacing them.
+var deleteConflicts = []string{
+	"no-empty", "append", "dry-run", "tee", "if-unmodified", "expect-sha256",
+	"no-clobber", "exchange", "journal",
+}
+
+// CheckEmpty checks the options for empty input.
+func CheckEmpty(c *cli.Context) error {
+	if !c.GlobalBool("delete-if-empty") {
+		return nil
+	}
+	if c.GlobalBool("no-empty") {
+		return errors.New("Choose one of --no-empty and --delete-if-empty.")
+	}
+	return RefuseFlags(c, deleteConflicts, "--delete-if-empty")
+}
+
+// RefusingEmpty reports whether empty input is refused rather than
+// written.
+func RefusingEmpty(c *cli.Context) bool {
+	return c.GlobalBool("no-empty") || c.GlobalBool("delete-if-empty")
+}
+
+// RefuseEmpty reads the first byte of in, failing with ErrEmptyInput if
+// there is none.  The byte is put back in front of the rest.  The wait
+// for it ends with ctx, and with --idle-timeout, like the rest of the
+// transfer.
+func RefuseEmpty(ctx context.Context, c *cli.Context, in io.ReadCloser) (io.ReadCloser, error) {
+	first := make([]byte, 1)
+	err := WithIdleTimeout(ctx, c, in, func(ctx context.Context, in io.Reader) error {
+		in, stop := sponge.InterruptibleReader(ctx, in)
+		defer stop()
+		_, err := io.ReadFull(in, first)
+		return err
+	})
+	if err == io.EOF {
+		return nil, ErrEmptyInput
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &peekedInput{io.MultiReader(bytes.NewReader(first), in), in}, nil
+}
+
+// peekedInput reads what was peeked from its input before the rest.
+type peekedInput struct {
+	io.Reader
+	io.Closer
+}
+
+// DeleteTargets backs up and removes each destination, for
+// --delete-if-empty.  Destinations which don't exist are left so.
+func DeleteTargets(ctx context.Context, c *cli.Context, bf sponge.Backup) error {
+	for _, target := range Targets(c) {
+		opts := sponge.Options{}
+		if err := GuardTarget(c, target, &opts); err != nil {
+			return err
+		}
+		if opts.Precondition != nil {
+			if err := opts.Precondition(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := bf.Begin(ctx); err != nil {
+		return err
+	}
+	if err := bf.Complete(); err != nil {
+		return err
+	}
+	for _, target := range Targets(c) {
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if c.GlobalBool("fsync") {
+			if err := sponge.SyncDir(filepath.Dir(target)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
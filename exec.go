@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/jmyounker/spunge/pkg/sponge"
+	"github.com/urfave/cli"
+)
+
+// execConflicts make no sense with --exec, whose input is the
+// destination itself.
+var execConflicts = []string{"input", "input-fd", "output-fd", "exec-output", "cas", "append", "no-clobber"}
+
+// CheckExec checks that --exec has a single local file to filter.
+func CheckExec(c *cli.Context) error {
+	if err := RefuseFlags(c, execConflicts, "--exec"); err != nil {
+		return err
+	}
+	if len(Targets(c)) != 1 {
+		return errors.New("--exec needs exactly one destination.")
+	}
+	target := Targets(c)[0]
+	if _, _, ok := sponge.SplitMember(target); ok || sponge.IsRemote(target) || target == sponge.StdoutTarget {
+		return errors.New("--exec can only filter a local file.")
+	}
+	return nil
+}
+
+// OpenExecInput starts the --exec command with the destination on its
+// stdin, and returns its output.
+func OpenExecInput(ctx context.Context, c *cli.Context) (io.ReadCloser, error) {
+	return OpenFilterInput(ctx, c.GlobalString("exec"), Targets(c)[0])
+}
+
+// OpenFilterInput starts the shell command script with the file fn on its
+// stdin, and returns its output.  If the command fails, reading the
+// output fails at its end, so nothing is committed.
+func OpenFilterInput(ctx context.Context, script, fn string) (io.ReadCloser, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	cmd := FilterCommand(ctx, script)
+	cmd.Stdin = f
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &execInput{out: out, cmd: cmd, file: f}, nil
+}
+
+// FilterCommand builds a shell command running script, which reads its
+// stdin and writes stdout.
+func FilterCommand(ctx context.Context, script string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, Shell[0], append(Shell[1:], script)...)
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// execInput reads a command's output, and reports its failure in place
+// of the end of the output.
+type execInput struct {
+	out  io.ReadCloser
+	cmd  *exec.Cmd
+	file *os.File
+	done bool
+	err  error
+}
+
+func (ei *execInput) Read(p []byte) (int, error) {
+	n, err := ei.out.Read(p)
+	if err == io.EOF {
+		if werr := ei.wait(); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// Waits for the command once its output is finished.
+func (ei *execInput) wait() error {
+	if ei.done {
+		return ei.err
+	}
+	ei.done = true
+	ei.file.Close()
+	if err := ei.cmd.Wait(); err != nil {
+		ei.err = fmt.Errorf("Command failed: %s", err)
+	}
+	return ei.err
+}
+
+func (ei *execInput) Close() error {
+	if !ei.done {
+		ei.cmd.Process.Kill()
+	}
+	ei.wait()
+	return nil
+}
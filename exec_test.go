@@ -0,0 +1,22 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckExecRefusesCAS(t *testing.T) {
+	cas := filepath.Join(t.TempDir(), "cas")
+	err := NewApp().Run([]string{"spunge", "--exec", "sort", "--cas", cas})
+	if err == nil || err.Error() != "--cas makes no sense with --exec" {
+		t.Fatalf("got %v, want --cas refused", err)
+	}
+}
+
+func TestCheckExecNeedsOneDestination(t *testing.T) {
+	dir := t.TempDir()
+	err := NewApp().Run([]string{"spunge", "--exec", "sort", filepath.Join(dir, "a"), filepath.Join(dir, "b")})
+	if err == nil || err.Error() != "--exec needs exactly one destination." {
+		t.Fatalf("got %v, want one destination required", err)
+	}
+}
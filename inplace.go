@@ -0,0 +1,18 @@
+package main
+
+import (
+	"github.com/urfave/cli"
+)
+
+// inPlaceConflicts make no sense when the destination is overwritten
+// rather than replaced by a tempfile.
+var inPlaceConflicts = []string{
+	"atomic", "memory", "max-memory", "memfd", "exchange", "no-clobber",
+	"sparse", "direct", "backend",
+}
+
+// CheckInPlace checks that --in-place is not given with options for
+// replacing the destination.
+func CheckInPlace(c *cli.Context) error {
+	return RefuseFlags(c, inPlaceConflicts, "--in-place")
+}
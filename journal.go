@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/jmyounker/spunge/pkg/sponge"
+	"github.com/urfave/cli"
+)
+
+// JournalEntry records one commit, or the undoing of one.
+type JournalEntry struct {
+	ID     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	Op     string    `json:"op"`
+	Target string    `json:"target"`
+	// Backup holds the target's previous contents.  It is empty when
+	// the commit created the target.
+	Backup    string `json:"backup,omitempty"`
+	OldSHA256 string `json:"old_sha256,omitempty"`
+	NewSHA256 string `json:"new_sha256,omitempty"`
+	// Undoes is the ID of the commit which an undo reverted.
+	Undoes string `json:"undoes,omitempty"`
+}
+
+// JournalFn returns the journal's filename, honoring --journal and
+// XDG_STATE_HOME.
+func JournalFn(c *cli.Context) (string, error) {
+	if c.GlobalString("journal") != "" {
+		return c.GlobalString("journal"), nil
+	}
+	stateDir := os.Getenv("XDG_STATE_HOME")
+	if stateDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		stateDir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateDir, "spunge", "journal"), nil
+}
+
+// Journaling applies when backups are made, because undo needs them.
+func Journaling(c *cli.Context) bool {
+	return BackupTemplate(c) != "" && !c.GlobalBool("no-journal")
+}
+
+// AppendJournal adds entries to the journal, one JSON object per line.
+func AppendJournal(fn string, entries []JournalEntry) error {
+	if err := os.MkdirAll(filepath.Dir(fn), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(fn, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// ReadJournal returns every entry in the journal.
+func ReadJournal(fn string) ([]JournalEntry, error) {
+	f, err := os.Open(fn)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries := []JournalEntry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("Corrupt journal %s: %s", fn, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// LastCommit returns the most recent commit to target which has not been
+// undone.
+func LastCommit(entries []JournalEntry, target string) (JournalEntry, bool) {
+	undone := map[string]bool{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Target != target {
+			continue
+		}
+		if e.Op == "undo" {
+			undone[e.Undoes] = true
+			continue
+		}
+		if e.Op == "commit" && !undone[e.ID] {
+			return e, true
+		}
+	}
+	return JournalEntry{}, false
+}
+
+// FileSHA256 returns the hex SHA-256 of fn's contents.
+func FileSHA256(fn string) (string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// JournalCommits records the commits of each changed target.  existed
+// says whether each target existed beforehand.
+func JournalCommits(c *cli.Context, targets []string, existed []bool, bf sponge.Backup, sf sponge.SpongeFile) error {
+	fn, err := JournalFn(c)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	backups := TargetBackups(bf, len(targets))
+	sponges := TargetSponges(sf)
+	entries := []JournalEntry{}
+	for i, target := range targets {
+		if ch, ok := sponges[i].(sponge.Changer); ok && !ch.Changed() {
+			continue
+		}
+		e := JournalEntry{
+			ID:   strconv.FormatInt(now.UnixNano(), 36) + "-" + strconv.Itoa(i),
+			Time: now,
+			Op:   "commit",
+		}
+		if e.Target, err = filepath.Abs(target); err != nil {
+			return err
+		}
+		if e.NewSHA256, err = FileSHA256(target); err != nil {
+			return err
+		}
+		if cb, ok := backups[i].(*sponge.ConcurrentBackup); ok && existed[i] {
+			if e.Backup, err = filepath.Abs(cb.BackupFn); err != nil {
+				return err
+			}
+			if e.OldSHA256, err = FileSHA256(cb.BackupFn); err != nil {
+				return err
+			}
+		}
+		entries = append(entries, e)
+	}
+	return AppendJournal(fn, entries)
+}
+
+// TargetsExist reports whether each destination currently exists.
+func TargetsExist(c *cli.Context) []bool {
+	existed := []bool{}
+	for _, target := range Targets(c) {
+		_, err := os.Stat(target)
+		existed = append(existed, err == nil)
+	}
+	return existed
+}
+
+// TargetBackups returns the backup for each of n destinations.
+func TargetBackups(bf sponge.Backup, n int) []sponge.Backup {
+	if mb, ok := bf.(*sponge.MultiBackup); ok {
+		return mb.Backups
+	}
+	// A single backup, or none at all, serves every destination.
+	backups := []sponge.Backup{}
+	for i := 0; i < n; i++ {
+		backups = append(backups, bf)
+	}
+	return backups
+}
+
+func UndoAction(c *cli.Context) error {
+	if len(c.Args()) != 1 {
+		return errors.New("Undo requires exactly one destination.")
+	}
+	target, err := filepath.Abs(c.Args().First())
+	if err != nil {
+		return err
+	}
+	fn, err := JournalFn(c)
+	if err != nil {
+		return err
+	}
+	entries, err := ReadJournal(fn)
+	if err != nil {
+		return err
+	}
+	e, ok := LastCommit(entries, target)
+	if !ok {
+		return fmt.Errorf("The journal has nothing to undo for %s.", target)
+	}
+	current, err := FileSHA256(target)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if current != e.NewSHA256 && !c.Bool("force") {
+		return fmt.Errorf("%s has changed since %s, use --force to undo anyway.", target, e.Time.Format(time.RFC3339))
+	}
+	if e.Backup == "" {
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		old, err := FileSHA256(e.Backup)
+		if err != nil {
+			return err
+		}
+		if old != e.OldSHA256 {
+			return fmt.Errorf("Backup %s no longer holds the previous contents of %s.", e.Backup, target)
+		}
+		if err := Restore(context.Background(), e.Backup, target, GetOptions(c)); err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	return AppendJournal(fn, []JournalEntry{{
+		ID:     strconv.FormatInt(now.UnixNano(), 36),
+		Time:   now,
+		Op:     "undo",
+		Target: target,
+		Undoes: e.ID,
+	}})
+}
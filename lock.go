@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/jmyounker/spunge/pkg/sponge"
+	"github.com/urfave/cli"
+)
+
+// DefaultLockFile names the sidecar locked by --lock.
+const DefaultLockFile = "{file}.lock"
+
+// Locking reports whether destinations are to be locked.
+func Locking(c *cli.Context) bool {
+	return c.GlobalBool("lock") || c.GlobalIsSet("lock-file") || c.GlobalBool("lock-dir")
+}
+
+// CheckLock checks the locking options.
+func CheckLock(c *cli.Context) error {
+	if c.GlobalIsSet("lock-timeout") {
+		if !Locking(c) {
+			return errors.New("--lock-timeout makes no sense without --lock")
+		}
+		if _, err := LockTimeout(c); err != nil {
+			return err
+		}
+	}
+	if c.GlobalIsSet("lock-stale") {
+		if !c.GlobalBool("lock-dir") {
+			return errors.New("--lock-stale makes no sense without --lock-dir")
+		}
+		if _, err := LockStale(c); err != nil {
+			return err
+		}
+	}
+	if c.GlobalIsSet("lock-file") {
+		fn, err := LockFileName(c, "x")
+		if err != nil {
+			return err
+		}
+		if fn == "x" && c.GlobalBool("lock-dir") {
+			return errors.New("--lock-dir cannot lock the destination itself, so give --lock-file another name")
+		}
+	}
+	return nil
+}
+
+// LockTimeout returns how long to wait for the locks, or zero to wait
+// for as long as it takes.
+func LockTimeout(c *cli.Context) (time.Duration, error) {
+	if !c.GlobalIsSet("lock-timeout") {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(c.GlobalString("lock-timeout"))
+	if err != nil || d <= 0 {
+		return 0, errors.New("--lock-timeout must be a positive duration, like 30s")
+	}
+	return d, nil
+}
+
+// LockStale returns how long a lock directory may go unrefreshed before
+// it is broken.
+func LockStale(c *cli.Context) (time.Duration, error) {
+	if !c.GlobalIsSet("lock-stale") {
+		return sponge.DefaultLockStale, nil
+	}
+	d, err := time.ParseDuration(c.GlobalString("lock-stale"))
+	if err != nil || d <= 0 {
+		return 0, errors.New("--lock-stale must be a positive duration, like 5m")
+	}
+	if d < sponge.MinLockStale {
+		return 0, fmt.Errorf("--lock-stale must be at least %s", sponge.MinLockStale)
+	}
+	return d, nil
+}
+
+// LockFileName returns the file locked for target.  An archive member's
+// lock is its archive's.
+func LockFileName(c *cli.Context, target string) (string, error) {
+	if archiveFn, _, ok := sponge.SplitMember(target); ok {
+		target = archiveFn
+	}
+	template := c.GlobalString("lock-file")
+	if template == "" {
+		template = DefaultLockFile
+	}
+	return sponge.LockFileName(template, target)
+}
+
+// LockDestination locks the destination fn itself.  A missing one isn't
+// created just to be locked, which would leave an empty destination
+// behind, so its sidecar lock file is locked instead.
+func LockDestination(ctx context.Context, fn string) (*sponge.Lock, error) {
+	l, err := sponge.AcquireExistingLock(ctx, fn)
+	if !os.IsNotExist(err) {
+		return l, err
+	}
+	sidecar, err := sponge.LockFileName(DefaultLockFile, fn)
+	if err != nil {
+		return nil, err
+	}
+	return sponge.AcquireLock(ctx, sidecar)
+}
+
+// LockTargets takes the locks for targets when asked to, and returns a
+// function releasing them.  They are taken in order of their names, so
+// runs locking the same destinations cannot deadlock.
+func LockTargets(ctx context.Context, c *cli.Context, targets []string) (func(), error) {
+	if !Locking(c) {
+		return func() {}, nil
+	}
+	// Names are mapped to whether they are the destination itself.
+	names := map[string]bool{}
+	for _, target := range targets {
+		fn, err := LockFileName(c, target)
+		if err != nil {
+			return nil, err
+		}
+		if archiveFn, _, ok := sponge.SplitMember(target); ok {
+			target = archiveFn
+		}
+		names[fn] = fn == target
+	}
+	fns := make([]string, 0, len(names))
+	for fn := range names {
+		fns = append(fns, fn)
+	}
+	sort.Strings(fns)
+	timeout, err := LockTimeout(c)
+	if err != nil {
+		return nil, err
+	}
+	stale, err := LockStale(c)
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	locks := []*sponge.Lock{}
+	release := func() {
+		for _, l := range locks {
+			if err := l.Release(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+	}
+	for _, fn := range fns {
+		var l *sponge.Lock
+		if c.GlobalBool("lock-dir") {
+			l, err = sponge.AcquireLockDir(ctx, fn, stale)
+		} else if names[fn] {
+			l, err = LockDestination(ctx, fn)
+		} else {
+			l, err = sponge.AcquireLock(ctx, fn)
+		}
+		if err != nil {
+			release()
+			return nil, err
+		}
+		locks = append(locks, l)
+	}
+	return release, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/urfave/cli"
+)
+
+// SystemLog is where --log-syslog records outcomes.
+type SystemLog interface {
+	Info(m string) error
+	Err(m string) error
+	Close() error
+}
+
+// LogReport records the outcome for each destination in the system log,
+// with failures at error priority.
+func LogReport(c *cli.Context, r *Report) error {
+	log, err := OpenSyslog()
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+	for _, m := range DescribeReport(c, r) {
+		if r.Outcome == "failed" || r.Error != "" {
+			err = log.Err(m)
+		} else {
+			err = log.Info(m)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DescribeReport summarizes r in one message per destination, naming
+// destinations by their absolute paths.
+func DescribeReport(c *cli.Context, r *Report) []string {
+	messages := []string{}
+	for i, target := range Targets(c) {
+		if abs, err := filepath.Abs(target); err == nil {
+			target = abs
+		}
+		outcome := r.Outcome
+		size := int64(-1)
+		if i < len(r.Targets) && r.Targets[i].Outcome != "failed" {
+			outcome = r.Targets[i].Outcome
+			size = r.Targets[i].Size
+		}
+		m := fmt.Sprintf("%s: %s", target, outcome)
+		if size >= 0 {
+			m += fmt.Sprintf(", %d bytes", size)
+		}
+		if r.Error != "" {
+			m += fmt.Sprintf(", %s failed: %s", r.Stage, r.Error)
+		}
+		messages = append(messages, m)
+	}
+	return messages
+}
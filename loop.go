@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jmyounker/spunge/pkg/sponge"
+	"github.com/urfave/cli"
+)
+
+// loopConflicts make no sense when the input is many records, each
+// committed on its own.
+var loopConflicts = []string{
+	"cas", "exec", "output-fd", "exec-output", "input-checksum", "backup",
+	"backup-numbered", "backup-dir", "backup-keep", "journal", "dry-run",
+	"diff", "confirm", "tee", "size-hint", "progress", "stats",
+	"expect-sha256", "delete-if-empty", "min-bytes", "max-bytes",
+	"idle-timeout",
+}
+
+// ParseDelimiter interprets the escapes in a --delimiter, such as \0 for
+// NUL or \n\n for a blank line.
+func ParseDelimiter(s string) ([]byte, error) {
+	if s == `\0` {
+		return []byte{0}, nil
+	}
+	delim, err := strconv.Unquote(`"` + s + `"`)
+	if err != nil || delim == "" {
+		return nil, fmt.Errorf("Invalid delimiter %q.", s)
+	}
+	return []byte(delim), nil
+}
+
+// CheckRecords checks how --framing or --delimiter split the input.
+func CheckRecords(c *cli.Context) error {
+	framing := c.GlobalString("framing")
+	if framing == "" {
+		if c.GlobalIsSet("delimiter") {
+			_, err := ParseDelimiter(c.GlobalString("delimiter"))
+			return err
+		}
+		return nil
+	}
+	if c.GlobalIsSet("delimiter") {
+		return errors.New("--delimiter makes no sense with --framing")
+	}
+	for _, format := range sponge.FrameFormats {
+		if framing == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown framing %q.", framing)
+}
+
+// OpenRecords splits in into records as --framing or --delimiter say.
+// The options must already have been checked.
+func OpenRecords(c *cli.Context, in io.Reader) (sponge.Records, error) {
+	if c.GlobalString("framing") != "" {
+		return sponge.NewFrameReader(in, c.GlobalString("framing"))
+	}
+	delim := []byte{0}
+	if c.GlobalIsSet("delimiter") {
+		delim, _ = ParseDelimiter(c.GlobalString("delimiter"))
+	}
+	return sponge.NewRecordReader(in, delim), nil
+}
+
+// LoopTarget expands the destination template for the nth record.
+func LoopTarget(template string, n int64, now time.Time) (string, error) {
+	return sponge.ExpandTemplate(template, map[string]string{
+		"{date}":   now.Format("20060102"),
+		"{time}":   now.Format("150405"),
+		"{record}": strconv.FormatInt(n, 10),
+		"{pid}":    strconv.Itoa(os.Getpid()),
+	})
+}
+
+// SpongeLoop commits each record of the input to the destination named
+// by the template DEST, until the input ends.
+func SpongeLoop(ctx context.Context, c *cli.Context, r *Report) error {
+	if len(c.Args()) > 1 {
+		return errors.New("--loop makes no sense with several destinations")
+	}
+	if err := RefuseFlags(c, loopConflicts, "--loop"); err != nil {
+		return err
+	}
+	if err := CheckRecords(c); err != nil {
+		return err
+	}
+	template := c.Args().First()
+	if _, err := LoopTarget(template, 0, time.Now()); err != nil {
+		return err
+	}
+	in, err := OpenInput(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	src, stop := sponge.InterruptibleReader(ctx, in)
+	defer stop()
+	records, err := OpenRecords(c, src)
+	if err != nil {
+		return err
+	}
+	Notify("READY=1", "STATUS=Reading records for "+template)
+	for n := int64(1); ; n++ {
+		r.Stage = "transfer"
+		rec, err := records.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target, err := LoopTarget(template, n, time.Now())
+		if err != nil {
+			return err
+		}
+		size, err := SpongeStream(ctx, c, rec, target)
+		if err != nil {
+			return fmt.Errorf("%s: %s", target, err)
+		}
+		r.committed = true
+		Notify(fmt.Sprintf("STATUS=Committed %d records, last %s (%d bytes)", n, target, size))
+	}
+}
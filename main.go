@@ -1,67 +1,831 @@
 package main
 
 import (
+	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"os"
 	"io"
 	"io/ioutil"
-	"errors"
-	"path"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
+	"filippo.io/age"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/jmyounker/spunge/pkg/sponge"
 	"github.com/urfave/cli"
 )
 
-var version string;
+var version string
 
-var READSIZE = 4096
+// Exit statuses other than general failure.
+const (
+	ExitUnchanged = 3
+	ExitPostCmd   = 4
+	ExitModified  = 5
+	ExitTimeout   = 6
+)
 
 func main() {
+	err := NewApp().Run(os.Args)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// NewApp returns the spunge command line application.
+func NewApp() *cli.App {
 	app := cli.NewApp()
 	app.Usage = "Accumulate data and write to storage when complete."
+	app.ArgsUsage = "DEST..."
 	app.Version = version
 
 	app.Flags = []cli.Flag{
 		cli.StringFlag{
+			Name:   "config",
+			EnvVar: "SPUNGE_CONFIG",
+			Usage:  "Read default flags from FILE instead of /etc/spunge.conf and ~/.config/spunge/config.toml.",
+		},
+		cli.StringSliceFlag{
 			Name:  "input, i",
-			Usage: "Read input from here.  Exists for testing.",
+			Usage: "Read input from here, a file, an http or https URL, or - for stdin.  May be repeated to concatenate several inputs.",
+		},
+		cli.IntFlag{
+			Name:   "input-fd",
+			EnvVar: "SPUNGE_INPUT_FD",
+			Usage:  "Read input from the open file descriptor N instead of stdin.",
+		},
+		cli.StringFlag{
+			Name:   "exec",
+			EnvVar: "SPUNGE_EXEC",
+			Usage:  "Filter the destination through the shell command CMD, replacing it with the output unless CMD fails.",
 		},
 		cli.StringFlag{
-			Name:  "backup, b",
-			Usage: "Backs up target to the specified file.",
+			Name:   "input-checksum",
+			EnvVar: "SPUNGE_INPUT_CHECKSUM",
+			Usage:  "Refuse to commit unless the input has the checksum ALGORITHM:HEX, like sha256:9f86d0...",
+		},
+		cli.IntFlag{
+			Name:   "input-retries",
+			EnvVar: "SPUNGE_INPUT_RETRIES",
+			Value:  3,
+			Usage:  "Resume an interrupted download from --input up to N times.",
+		},
+		cli.StringFlag{
+			Name:   "backup, b",
+			EnvVar: "SPUNGE_BACKUP",
+			Usage:  "Backs up target to the specified file.",
 		},
 		cli.BoolFlag{
-			Name:  "atomic, a",
-			Usage: "Write atomicly. Only needed with --memory.",
+			Name:   "backup-numbered",
+			EnvVar: "SPUNGE_BACKUP_NUMBERED",
+			Usage:  "Make numbered backups like file.~1~ and file.~2~.  Numbers the --backup template if given.",
+		},
+		cli.StringFlag{
+			Name:   "backup-dir",
+			EnvVar: "SPUNGE_BACKUP_DIR",
+			Usage:  "Keep backups under DIR, mirroring each destination's absolute path.",
+		},
+		cli.IntFlag{
+			Name:   "backup-keep",
+			EnvVar: "SPUNGE_BACKUP_KEEP",
+			Usage:  "After committing, keep only the newest N backups made from the --backup template.",
+		},
+		cli.StringFlag{
+			Name:   "journal",
+			EnvVar: "SPUNGE_JOURNAL",
+			Usage:  "Record commits made with backups in this journal.  Defaults to $XDG_STATE_HOME/spunge/journal.",
+		},
+		cli.BoolFlag{
+			Name:   "no-journal",
+			EnvVar: "SPUNGE_NO_JOURNAL",
+			Usage:  "Do not record commits in the journal.",
+		},
+		cli.BoolFlag{
+			Name:   "atomic, a",
+			EnvVar: "SPUNGE_ATOMIC",
+			Usage:  "Write atomicly. Only needed with --memory.",
+		},
+		cli.BoolFlag{
+			Name:   "memory, m",
+			EnvVar: "SPUNGE_MEMORY",
+			Usage:  "Accumuate data in memory.",
+		},
+		cli.StringFlag{
+			Name:   "max-memory",
+			EnvVar: "SPUNGE_MAX_MEMORY",
+			Usage:  "Accumulate up to SIZE bytes in memory before spilling to a tempfile.",
 		},
 		cli.BoolFlag{
-			Name:  "memory, m",
-			Usage: "Accumuate data in memory.",
+			Name:   "memfd",
+			EnvVar: "SPUNGE_MEMFD",
+			Usage:  "Accumulate data in a Linux memory file outside the Go heap, then replace the destination atomically.",
+		},
+		cli.StringFlag{
+			Name:   "mode",
+			EnvVar: "SPUNGE_MODE",
+			Usage:  "Give destinations MODE, in octal like 0640 or symbolic like u=rw,g=r, instead of keeping their current mode.",
+		},
+		cli.StringFlag{
+			Name:   "reference",
+			EnvVar: "SPUNGE_REFERENCE",
+			Usage:  "Give destinations the mode, owner, group, times, and extended attributes of FILE.",
+		},
+		cli.StringFlag{
+			Name:   "owner",
+			EnvVar: "SPUNGE_OWNER",
+			Usage:  "Give destinations to USER, a name or numeric uid.  Usually requires root.",
+		},
+		cli.StringFlag{
+			Name:   "group",
+			EnvVar: "SPUNGE_GROUP",
+			Usage:  "Give destinations to GROUP, a name or numeric gid.",
+		},
+		cli.StringSliceFlag{
+			Name:   "preserve",
+			EnvVar: "SPUNGE_PRESERVE",
+			Usage:  fmt.Sprintf("Keep the replaced destination's ATTRS, a comma-separated list of %s.", PreserverNames()),
+		},
+		cli.BoolFlag{
+			Name:   "preserve-times",
+			EnvVar: "SPUNGE_PRESERVE_TIMES",
+			Usage:  "Keep the replaced destination's access and modification times.  Same as --preserve times.",
+		},
+		cli.BoolFlag{
+			Name:   "append",
+			EnvVar: "SPUNGE_APPEND",
+			Usage:  "Append to the destination instead of replacing it.",
+		},
+		cli.StringFlag{
+			Name:   "exchange",
+			EnvVar: "SPUNGE_EXCHANGE",
+			Usage:  "Atomically swap the new data into place, leaving the old contents at OLDCOPY, a template like --backup's.  Must be on the same filesystem.",
+		},
+		cli.BoolFlag{
+			Name:   "no-empty",
+			EnvVar: "SPUNGE_NO_EMPTY",
+			Usage:  "Leave the destination alone if the input is empty, and fail.",
+		},
+		cli.BoolFlag{
+			Name:   "delete-if-empty",
+			EnvVar: "SPUNGE_DELETE_IF_EMPTY",
+			Usage:  "Delete the destination if the input is empty, after backing it up.",
+		},
+		cli.StringFlag{
+			Name:   "fallback-target",
+			EnvVar: "SPUNGE_FALLBACK_TARGET",
+			Usage:  "Save the data in PATH instead, and fail, if the destination's filesystem is read-only.  PATH expands placeholders like --backup.",
+		},
+		cli.BoolFlag{
+			Name:   "check-space",
+			EnvVar: "SPUNGE_CHECK_SPACE",
+			Usage:  "Fail before writing the data into the destination's filesystem if there isn't room for it, rather than part way through.",
+		},
+		cli.IntFlag{
+			Name:   "rename-retries",
+			Value:  sponge.RenameRetries,
+			EnvVar: "SPUNGE_RENAME_RETRIES",
+			Usage:  fmt.Sprintf("Retry moving the data into place up to N times, at most %d, waiting twice as long each time up to %s, while the destination is briefly busy.", sponge.MaxRenameRetries, sponge.MaxRenameDelay),
+		},
+		cli.DurationFlag{
+			Name:   "timeout",
+			EnvVar: "SPUNGE_TIMEOUT",
+			Usage:  fmt.Sprintf("Give up, exiting with %d, unless the input is read and committed within DURATION.", ExitTimeout),
+		},
+		cli.DurationFlag{
+			Name:   "idle-timeout",
+			EnvVar: "SPUNGE_IDLE_TIMEOUT",
+			Usage:  "Give up, leaving the destination alone, once no input has arrived for DURATION, like 30s or 5m.",
+		},
+		cli.StringFlag{
+			Name:   "min-bytes",
+			EnvVar: "SPUNGE_MIN_BYTES",
+			Usage:  "Leave the destination alone if the input is smaller than SIZE, like 4096 or 64K, and fail.",
+		},
+		cli.StringFlag{
+			Name:   "max-bytes",
+			EnvVar: "SPUNGE_MAX_BYTES",
+			Usage:  "Leave the destination alone if the input is larger than SIZE, like 4096 or 1G, and fail as soon as it is.",
+		},
+		cli.StringFlag{
+			Name:   "name",
+			EnvVar: "SPUNGE_NAME",
+			Usage:  "Call the file written into a directory destination NAME, instead of naming it after the input.",
+		},
+		cli.BoolFlag{
+			Name:   "parents, p",
+			EnvVar: "SPUNGE_PARENTS",
+			Usage:  "Create any missing directories above the destinations, like mkdir -p.",
+		},
+		cli.StringFlag{
+			Name:   "parents-mode",
+			EnvVar: "SPUNGE_PARENTS_MODE",
+			Usage:  "Give the directories made by --parents MODE, in octal or symbolic, instead of 0777 less the umask.",
+		},
+		cli.BoolFlag{
+			Name:   "follow-symlinks",
+			EnvVar: "SPUNGE_FOLLOW_SYMLINKS",
+			Usage:  "When a destination is a symlink, replace the file it points to, keeping the link.",
+		},
+		cli.BoolFlag{
+			Name:   "replace-symlink",
+			EnvVar: "SPUNGE_REPLACE_SYMLINK",
+			Usage:  "When a destination is a symlink, replace the link itself with the new file.  This is the default.",
+		},
+		cli.BoolFlag{
+			Name:   "no-follow",
+			EnvVar: "SPUNGE_NO_FOLLOW",
+			Usage:  "Refuse destinations and temp directories reached through a symlink, as a best-effort guard against symlink attacks.  A symlink swapped in just before committing can still get through.",
+		},
+		cli.BoolFlag{
+			Name:   "in-place",
+			EnvVar: "SPUNGE_IN_PLACE",
+			Usage:  "Once the input is complete, overwrite the destination's contents instead of replacing it, keeping its inode for hard links and watchers.  Not atomic.",
+		},
+		cli.BoolFlag{
+			Name:   "no-clobber",
+			EnvVar: "SPUNGE_NO_CLOBBER",
+			Usage:  fmt.Sprintf("Only create the destination, leaving it alone and exiting with %d if it already exists, even if another writer creates it first.", ExitModified),
+		},
+		cli.StringFlag{
+			Name:   "size-hint",
+			EnvVar: "SPUNGE_SIZE_HINT",
+			Usage:  "Reserve SIZE bytes of storage for the tempfile up front, failing early if there is no room.",
+		},
+		cli.BoolFlag{
+			Name:   "direct",
+			EnvVar: "SPUNGE_DIRECT",
+			Usage:  "Write the tempfile with direct I/O, bypassing the page cache.",
+		},
+		cli.StringFlag{
+			Name:   "backend",
+			EnvVar: "SPUNGE_BACKEND",
+			Usage:  "Write the tempfile with NAME: file, or the experimental iouring on Linux.",
+		},
+		cli.BoolFlag{
+			Name:   "sparse",
+			EnvVar: "SPUNGE_SPARSE",
+			Usage:  "Leave holes in the destination instead of writing long runs of zeros.",
+		},
+		cli.BoolFlag{
+			Name:   "fsync",
+			EnvVar: "SPUNGE_FSYNC",
+			Usage:  "Flush data and the destination directory to storage when committing.",
+		},
+		cli.BoolFlag{
+			Name:   "dry-run, n",
+			EnvVar: "SPUNGE_DRY_RUN",
+			Usage:  "Report what would be written to each destination without changing anything.",
+		},
+		cli.BoolFlag{
+			Name:   "diff",
+			EnvVar: "SPUNGE_DIFF",
+			Usage:  "Print a unified diff of each destination's changes on stderr before committing.",
+		},
+		cli.BoolFlag{
+			Name:   "confirm",
+			EnvVar: "SPUNGE_CONFIRM",
+			Usage:  "Ask on the terminal before committing each destination.",
+		},
+		cli.BoolFlag{
+			Name:   "skip-unchanged",
+			EnvVar: "SPUNGE_SKIP_UNCHANGED",
+			Usage:  fmt.Sprintf("Leave the destination alone if its contents would not change, exiting with %d.", ExitUnchanged),
+		},
+		cli.StringFlag{
+			Name:   "compress",
+			EnvVar: "SPUNGE_COMPRESS",
+			Usage:  "Compress the data written to the destination with FORMAT (gzip, zstd, xz, lz4, bzip2).",
+		},
+		cli.IntFlag{
+			Name:   "compress-level",
+			EnvVar: "SPUNGE_COMPRESS_LEVEL",
+			Usage:  "Use compression level N.  The range depends upon the format.",
+		},
+		cli.StringFlag{
+			Name:   "decompress",
+			EnvVar: "SPUNGE_DECOMPRESS",
+			Usage:  "Decompress the input from FORMAT, or detect it with 'auto'.",
+		},
+		cli.StringSliceFlag{
+			Name:   "encrypt-age",
+			EnvVar: "SPUNGE_ENCRYPT_AGE",
+			Usage:  "Encrypt the data with age for RECIPIENT, an age or SSH public key.  May be repeated.",
+		},
+		cli.StringSliceFlag{
+			Name:   "encrypt-gpg",
+			EnvVar: "SPUNGE_ENCRYPT_GPG",
+			Usage:  "Encrypt the data with OpenPGP for KEYID, a key ID, fingerprint, or user ID.  May be repeated.",
+		},
+		cli.StringFlag{
+			Name:   "gpg-keyring",
+			EnvVar: "SPUNGE_GPG_KEYRING",
+			Usage:  "Find --encrypt-gpg keys in this public keyring.  Defaults to ~/.gnupg/pubring.gpg.",
+		},
+		cli.BoolFlag{
+			Name:   "armor",
+			EnvVar: "SPUNGE_ARMOR",
+			Usage:  "ASCII armor --encrypt-gpg output.",
+		},
+		cli.StringFlag{
+			Name:   "checksum",
+			EnvVar: "SPUNGE_CHECKSUM",
+			Usage:  "Write a checksum file named after the destination plus ALGORITHM (md5, sha1, sha256, sha512, blake2b).",
+		},
+		cli.StringFlag{
+			Name:   "verify-cmd",
+			EnvVar: "SPUNGE_VERIFY_CMD",
+			Usage:  "Only commit if CMD succeeds.  CMD runs in the shell with {} replaced by the tempfile's name.",
+		},
+		cli.StringFlag{
+			Name:   "post-cmd",
+			EnvVar: "SPUNGE_POST_CMD",
+			Usage:  fmt.Sprintf("Run CMD after committing.  CMD runs in the shell with {} replaced by the destination.  Exits with %d if CMD fails.", ExitPostCmd),
+		},
+		cli.BoolFlag{
+			Name:   "if-unmodified",
+			EnvVar: "SPUNGE_IF_UNMODIFIED",
+			Usage:  fmt.Sprintf("Leave the destination alone if someone else changes it while the input is read, exiting with %d.", ExitModified),
+		},
+		cli.StringFlag{
+			Name:   "expect-sha256",
+			EnvVar: "SPUNGE_EXPECT_SHA256",
+			Usage:  fmt.Sprintf("Only replace a destination whose contents have the SHA-256 digest HEX, and otherwise exit with %d.", ExitModified),
+		},
+		cli.BoolFlag{
+			Name:   "tee",
+			EnvVar: "SPUNGE_TEE",
+			Usage:  "Also write the data to stdout once it has been committed.",
+		},
+		cli.StringFlag{
+			Name:   "cas",
+			EnvVar: "SPUNGE_CAS",
+			Usage:  "Store the input under DIR, named after its SHA-256 digest like DIR/ab/cdef..., and print the name.  Stored data is not written twice.",
+		},
+		cli.IntFlag{
+			Name:   "output-fd",
+			EnvVar: "SPUNGE_OUTPUT_FD",
+			Usage:  "Write the data over the open file descriptor N, such as one passed by a supervisor, instead of a named destination.",
 		},
 		cli.StringFlag{
-			Name:  "tmpdir, t",
-			Usage: "Put the tempfile in this drectory.  Must be on the same filesystem.",
+			Name:   "exec-output",
+			EnvVar: "SPUNGE_EXEC_OUTPUT",
+			Usage:  "Once the input is complete, run the shell command CMD with the data on its stdin, instead of writing a destination.",
+		},
+		cli.BoolFlag{
+			Name:   "loop",
+			EnvVar: "SPUNGE_LOOP",
+			Usage:  "Commit each record of the input as soon as it ends, to DEST with {record}, {date}, {time}, and {pid} expanded.",
+		},
+		cli.StringFlag{
+			Name:   "delimiter",
+			EnvVar: "SPUNGE_DELIMITER",
+			Usage:  "End --loop records with DELIM, using escapes like \\n\\n for a blank line.  Defaults to \\0, a NUL byte.",
+		},
+		cli.StringFlag{
+			Name:   "framing",
+			EnvVar: "SPUNGE_FRAMING",
+			Usage:  "Read --loop records, or serve's streams, as frames in FORMAT: length, each after a 4-byte big-endian length, or netstring.",
+		},
+		cli.BoolFlag{
+			Name:   "lock",
+			EnvVar: "SPUNGE_LOCK",
+			Usage:  "Lock each destination's sidecar DEST.lock while reading the input and committing, waiting for other holders.",
+		},
+		cli.StringFlag{
+			Name:   "lock-file",
+			EnvVar: "SPUNGE_LOCK_FILE",
+			Usage:  "Lock the file named by TEMPLATE, with placeholders like {file}, {dir}, and {base}, instead of DEST.lock.  {file} locks the destination itself, or DEST.lock while it doesn't exist.  Implies --lock.",
+		},
+		cli.BoolFlag{
+			Name:   "lock-dir",
+			EnvVar: "SPUNGE_LOCK_DIR",
+			Usage:  "Lock by creating the directory DEST.lock, which works between hosts on NFS.  Implies --lock.",
+		},
+		cli.StringFlag{
+			Name:   "lock-stale",
+			EnvVar: "SPUNGE_LOCK_STALE",
+			Usage:  fmt.Sprintf("Break a --lock-dir lock whose holder hasn't refreshed it for DURATION, at least %s.  Defaults to %s.", sponge.MinLockStale, sponge.DefaultLockStale),
+		},
+		cli.StringFlag{
+			Name:   "lock-timeout",
+			EnvVar: "SPUNGE_LOCK_TIMEOUT",
+			Usage:  "Give up waiting for a lock after DURATION, like 30s.",
+		},
+		cli.StringFlag{
+			Name:   "tmpdir, t",
+			EnvVar: "SPUNGE_TMPDIR",
+			Usage:  "Put the tempfile in this directory.  On another filesystem the data is copied beside the destination before it is renamed into place.",
+		},
+		cli.StringFlag{
+			Name:   "tmpname",
+			EnvVar: "SPUNGE_TMPNAME",
+			Usage:  fmt.Sprintf("Name the tempfile after TEMPLATE, which may use {pid}, {rand}, and {time}, and gets {rand} before its extension if it uses none of them or the name is taken.  Defaults to %s.", sponge.DefaultTempName),
+		},
+		cli.StringFlag{
+			Name:   "buffer-size",
+			EnvVar: "SPUNGE_BUFFER_SIZE",
+			Usage:  "Read input SIZE bytes at a time.  Defaults to the destination filesystem's preferred I/O size, between 64K and 1M.",
+		},
+		cli.BoolFlag{
+			Name:   "pipeline",
+			EnvVar: "SPUNGE_PIPELINE",
+			Usage:  "Read the input while writing earlier input, for when both are slow.",
+		},
+		cli.BoolFlag{
+			Name:   "progress",
+			EnvVar: "SPUNGE_PROGRESS",
+			Usage:  "Report bytes read, throughput, and with a known size the time left, on stderr.",
+		},
+		cli.BoolFlag{
+			Name:   "stats",
+			EnvVar: "SPUNGE_STATS",
+			Usage:  "When finished, summarize each destination on stderr: bytes, time, throughput, backup, and whether it changed.",
+		},
+		cli.StringFlag{
+			Name:   "report-json",
+			EnvVar: "SPUNGE_REPORT_JSON",
+			Usage:  "Write a JSON report of the outcome, including failures, to FILE, or to stdout if FILE is -.",
+		},
+		cli.BoolFlag{
+			Name:   "log-syslog",
+			EnvVar: "SPUNGE_LOG_SYSLOG",
+			Usage:  "Record each destination's outcome, success or failure, in the system log.",
+		},
+		cli.StringFlag{
+			Name:   "metrics-push",
+			EnvVar: "SPUNGE_METRICS_PUSH",
+			Usage:  "Push metrics about the run to the Prometheus Pushgateway at URL.",
+		},
+		cli.StringFlag{
+			Name:   "throttle",
+			EnvVar: "SPUNGE_THROTTLE",
+			Usage:  "Read at most RATE bytes of input per second, like 10M.",
 		},
 	}
+	app.Before = LoadConfig
 	app.Action = SpongeAction
-
-	err := app.Run(os.Args)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	app.Commands = []cli.Command{
+		{
+			Name:      "restore",
+			Usage:     "Put the newest backup of DEST back in place.  Give the same backup options used when writing.",
+			ArgsUsage: "DEST",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "list, l",
+					Usage: "List the backups, newest first, instead of restoring.",
+				},
+			},
+			Action: RestoreAction,
+		},
+		{
+			Name:  "serve",
+			Usage: "Accept streams on a Unix socket or over HTTP, committing each to its own destination when it ends.",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "socket",
+					Usage: "Listen on the Unix socket PATH.",
+				},
+				cli.StringFlag{
+					Name:  "target",
+					Usage: "Name each stream's destination with TEMPLATE, using {date}, {time}, {conn}, {pid}, and with --framing {record}.",
+				},
+				cli.StringFlag{
+					Name:  "http",
+					Usage: "Listen for HTTP on ADDR instead, installing the body of each PUT or POST under --root.",
+				},
+				cli.StringFlag{
+					Name:  "root",
+					Usage: "Install HTTP uploads under DIR, at the request's path.",
+				},
+			},
+			Action: ServeAction,
+		},
+		{
+			Name:      "each",
+			Usage:     "Filter each FILE through a command, replacing it with the output unless the command fails.",
+			ArgsUsage: "[FILE...]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "exec",
+					Usage: "Filter with the shell command CMD, which gets each file on its stdin.",
+				},
+				cli.IntFlag{
+					Name:  "jobs, j",
+					Value: DefaultJobs,
+					Usage: "Filter up to N files at once.",
+				},
+				cli.StringFlag{
+					Name:  "files-from",
+					Usage: "Also filter the files listed in FILE, one per line, or in stdin if FILE is -.",
+				},
+				cli.BoolFlag{
+					Name:  "null, 0",
+					Usage: "End the names in --files-from with NUL instead of newline, as from find -print0.",
+				},
+				cli.StringSliceFlag{
+					Name:  "glob",
+					Usage: "Also filter the files matching PATTERN, where ** matches any number of directories.  May be repeated.",
+				},
+				cli.StringSliceFlag{
+					Name:  "recursive, r",
+					Usage: "Also filter every file under DIR.  May be repeated.",
+				},
+				cli.StringSliceFlag{
+					Name:  "include",
+					Usage: "Only filter --glob and --recursive files matching PATTERN.  May be repeated.",
+				},
+				cli.StringSliceFlag{
+					Name:  "exclude",
+					Usage: "Skip --glob and --recursive files, and --recursive directories, matching PATTERN.  May be repeated.",
+				},
+			},
+			Action: EachAction,
+		},
+		{
+			Name:      "undo",
+			Usage:     "Revert the most recent journaled commit to DEST.",
+			ArgsUsage: "DEST",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "force, f",
+					Usage: "Undo even if DEST has changed since the commit.",
+				},
+			},
+			Action: UndoAction,
+		},
 	}
+	return app
 }
 
 func SpongeAction(c *cli.Context) error {
-	if len(c.Args()) == 0 {
+	ctx, caught := SignalContext(context.Background())
+	if timeout := c.GlobalDuration("timeout"); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	stopWatchdog := StartWatchdog()
+	r := NewReport()
+	err := Sponge(ctx, c, r)
+	var modified *sponge.ModifiedError
+	if errors.As(err, &modified) {
+		err = cli.NewExitError(err.Error(), ExitModified)
+	}
+	if err != nil && !r.committed && ctx.Err() == context.DeadlineExceeded {
+		err = cli.NewExitError(TimeoutMessage(c, r), ExitTimeout)
+	}
+	stopWatchdog()
+	if sig := caught(); sig != nil {
+		err = cli.NewExitError(fmt.Sprintf("Interrupted by %s.", sig), SignalExitCode(sig))
+	}
+	r.Finish(err)
+	Notify("STOPPING=1", "STATUS="+DescribeOutcome(r))
+	if fn := c.GlobalString("report-json"); fn != "" {
+		if err := WriteReport(context.Background(), fn, r); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot write report: %s\n", err)
+		}
+	}
+	if c.GlobalBool("log-syslog") {
+		if err := LogReport(c, r); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot log to syslog: %s\n", err)
+		}
+	}
+	if url := c.GlobalString("metrics-push"); url != "" && len(c.Args()) > 0 {
+		if err := PushMetrics(c, url, r); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot push metrics: %s\n", err)
+		}
+	}
+	return err
+}
+
+func Sponge(ctx context.Context, c *cli.Context, r *Report) error {
+	if len(c.Args()) == 0 && c.GlobalString("cas") == "" && !c.GlobalIsSet("output-fd") && c.GlobalString("exec-output") == "" {
 		return errors.New("Destination file required.")
 	}
-	if len(c.Args()) > 1 {
-		return errors.New("Can only sponge to one destination.")
+	if err := ResolveTargets(c); err != nil {
+		return err
 	}
 	if c.GlobalBool("atomic") && !c.GlobalBool("memory") {
 		return errors.New("--atomic makes no sense wihout --memory")
 	}
+	if err := SetBufferSize(c, Targets(c)); err != nil {
+		return err
+	}
+	if err := SetRenameRetries(c); err != nil {
+		return err
+	}
+	if c.GlobalIsSet("size-hint") {
+		if _, err := ParseSize(c.GlobalString("size-hint")); err != nil {
+			return err
+		}
+	}
+	if c.GlobalIsSet("throttle") {
+		rate, err := ParseSize(c.GlobalString("throttle"))
+		if err != nil {
+			return err
+		}
+		if rate <= 0 {
+			return errors.New("--throttle must be positive")
+		}
+	}
+	if c.GlobalIsSet("max-memory") && c.GlobalBool("memory") {
+		return errors.New("--max-memory makes no sense with --memory")
+	}
+	if c.GlobalBool("memfd") && (c.GlobalBool("memory") || c.GlobalIsSet("max-memory")) {
+		return errors.New("Choose one of --memfd, --memory, and --max-memory.")
+	}
+	if c.GlobalBool("direct") && (c.GlobalBool("memory") || c.GlobalBool("memfd")) {
+		return errors.New("--direct requires a tempfile, so it makes no sense with --memory or --memfd")
+	}
+	if c.GlobalBool("direct") && c.GlobalBool("sparse") {
+		return errors.New("--direct makes no sense with --sparse")
+	}
+	switch c.GlobalString("backend") {
+	case "", "file":
+	case "iouring":
+		if c.GlobalBool("memory") || c.GlobalBool("memfd") {
+			return errors.New("--backend iouring requires a tempfile, so it makes no sense with --memory or --memfd")
+		}
+		if c.GlobalBool("direct") || c.GlobalBool("sparse") {
+			return errors.New("--backend iouring makes no sense with --direct or --sparse")
+		}
+	default:
+		return fmt.Errorf("Unknown backend %q.", c.GlobalString("backend"))
+	}
+	if c.GlobalIsSet("backup-keep") && BackupTemplate(c) == "" {
+		return errors.New("--backup-keep makes no sense without --backup")
+	}
+	if c.GlobalIsSet("compress-level") && !c.GlobalIsSet("compress") {
+		return errors.New("--compress-level makes no sense without --compress")
+	}
+	encrypted := c.GlobalIsSet("encrypt-age") || c.GlobalIsSet("encrypt-gpg")
+	if c.GlobalBool("no-clobber") {
+		if err := RefuseFlags(c, []string{"append", "expect-sha256", "exchange"}, "--no-clobber"); err != nil {
+			return err
+		}
+	}
+	if err := CheckParents(c); err != nil {
+		return err
+	}
+	if err := CheckEmpty(c); err != nil {
+		return err
+	}
+	if err := CheckSizeLimits(c); err != nil {
+		return err
+	}
+	if c.GlobalIsSet("idle-timeout") && c.GlobalDuration("idle-timeout") <= 0 {
+		return errors.New("--idle-timeout must be positive")
+	}
+	if c.GlobalIsSet("timeout") && c.GlobalDuration("timeout") <= 0 {
+		return errors.New("--timeout must be positive")
+	}
+	if c.GlobalBool("no-follow") && c.GlobalBool("follow-symlinks") {
+		return errors.New("--no-follow makes no sense with --follow-symlinks")
+	}
+	if c.GlobalBool("replace-symlink") {
+		if c.GlobalBool("follow-symlinks") {
+			return errors.New("Choose one of --follow-symlinks and --replace-symlink.")
+		}
+		if c.GlobalBool("in-place") || c.GlobalBool("memory") && !c.GlobalBool("atomic") {
+			return errors.New("--replace-symlink requires a tempfile, but --in-place and --memory write through symlinks")
+		}
+	}
+	if c.GlobalBool("in-place") {
+		if err := CheckInPlace(c); err != nil {
+			return err
+		}
+	}
+	if err := sponge.CheckTempName(c.GlobalString("tmpname")); err != nil {
+		return err
+	}
+	if c.GlobalString("fallback-target") != "" {
+		if _, err := sponge.BackupFile(c.GlobalString("fallback-target"), "x"); err != nil {
+			return err
+		}
+	}
+	if c.GlobalString("exchange") != "" {
+		if c.GlobalBool("memory") && !c.GlobalBool("atomic") {
+			return errors.New("--exchange requires a tempfile, so --memory needs --atomic")
+		}
+		if _, err := sponge.BackupFile(c.GlobalString("exchange"), "x"); err != nil {
+			return err
+		}
+	}
+	if encrypted && c.GlobalBool("append") {
+		return errors.New("--append cannot add to an encrypted destination")
+	}
+	if c.GlobalIsSet("encrypt-age") && c.GlobalIsSet("encrypt-gpg") {
+		return errors.New("Choose one of --encrypt-age and --encrypt-gpg.")
+	}
+	if c.GlobalBool("armor") && !c.GlobalIsSet("encrypt-gpg") {
+		return errors.New("--armor makes no sense without --encrypt-gpg")
+	}
+	if c.GlobalIsSet("verify-cmd") && c.GlobalBool("memory") && !c.GlobalBool("atomic") {
+		return errors.New("--verify-cmd requires a tempfile, so --memory needs --atomic")
+	}
+	if c.GlobalBool("diff") && c.GlobalBool("memory") && !c.GlobalBool("atomic") {
+		return errors.New("--diff requires a tempfile, so --memory needs --atomic")
+	}
+	if c.GlobalBool("confirm") && c.GlobalBool("memory") && !c.GlobalBool("atomic") {
+		return errors.New("--confirm requires a tempfile, so --memory needs --atomic")
+	}
+	if c.GlobalString("mode") != "" {
+		if _, err := sponge.ParseMode(c.GlobalString("mode")); err != nil {
+			return err
+		}
+	}
+	if _, err := GetChown(c); err != nil {
+		return err
+	}
+	if c.GlobalString("reference") != "" {
+		if _, _, err := sponge.Reference(c.GlobalString("reference")); err != nil {
+			return err
+		}
+	}
+	if _, err := GetPreserve(c); err != nil {
+		return err
+	}
+	if c.GlobalString("input-checksum") != "" {
+		if _, _, err := ParseInputChecksum(c.GlobalString("input-checksum")); err != nil {
+			return err
+		}
+	}
+	if c.GlobalInt("input-retries") < 0 {
+		return errors.New("--input-retries must not be negative")
+	}
+	if c.GlobalIsSet("input-fd") {
+		if len(c.GlobalStringSlice("input")) > 0 {
+			return errors.New("--input-fd makes no sense with --input")
+		}
+		if c.GlobalInt("input-fd") < 0 {
+			return errors.New("--input-fd must not be negative")
+		}
+	}
+	if err := CheckLock(c); err != nil {
+		return err
+	}
+	if err := CheckExpectedDigest(c); err != nil {
+		return err
+	}
+	if err := CheckRemoteTargets(c, Targets(c)); err != nil {
+		return err
+	}
+	if err := CheckMemberTargets(c, Targets(c)); err != nil {
+		return err
+	}
+	if err := CheckStdoutTarget(c, Targets(c)); err != nil {
+		return err
+	}
+	if c.GlobalString("exec") != "" {
+		if err := CheckExec(c); err != nil {
+			return err
+		}
+	}
+	if c.GlobalBool("confirm") && c.GlobalBool("dry-run") {
+		return errors.New("--confirm makes no sense with --dry-run")
+	}
+	if c.GlobalString("report-json") == "-" && c.GlobalBool("tee") {
+		return errors.New("--report-json - makes no sense with --tee")
+	}
+	if c.GlobalIsSet("delimiter") && !c.GlobalBool("loop") {
+		return errors.New("--delimiter makes no sense without --loop")
+	}
+	if c.GlobalIsSet("framing") && !c.GlobalBool("loop") {
+		return errors.New("--framing makes no sense without --loop")
+	}
+	if c.GlobalBool("loop") {
+		return SpongeLoop(ctx, c, r)
+	}
+	if c.GlobalIsSet("output-fd") {
+		return SpongeOutputFD(ctx, c, r)
+	}
+	if c.GlobalString("exec-output") != "" {
+		return SpongeExecOutput(ctx, c, r)
+	}
+	if c.GlobalString("cas") != "" {
+		return SpongeCAS(ctx, c, r)
+	}
+	if c.GlobalBool("dry-run") {
+		if c.GlobalBool("tee") {
+			return errors.New("--tee makes no sense with --dry-run")
+		}
+		r.Outcome = "dry-run"
+		return DryRun(ctx, c)
+	}
+	if err := MakeParents(c, Targets(c)); err != nil {
+		return err
+	}
+	// The destinations are locked before they are looked at.
+	r.Stage = "lock"
+	unlock, err := LockTargets(ctx, c, Targets(c))
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	bf, err := GetBackup(c)
 	if err != nil {
 		return err
@@ -70,391 +834,674 @@ func SpongeAction(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	in, err := OpenInput(c)
+	replay, isReplayer := sf.(sponge.Replayer)
+	if c.GlobalBool("tee") && !isReplayer {
+		return errors.New("--tee is not supported by this destination")
+	}
+	in, err := OpenInput(ctx, c)
+	if err == ErrEmptyInput && c.GlobalBool("delete-if-empty") {
+		r.Stage = "delete"
+		if err := DeleteTargets(ctx, c, bf); err != nil {
+			return err
+		}
+		r.Outcome = "deleted"
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 	defer in.Close()
-	if err := bf.Begin(); err != nil {
-		return err;
+	existed := TargetsExist(c)
+	r.Stage = "begin"
+	if err := bf.Begin(ctx); err != nil {
+		return err
 	}
-	if err := sf.Begin(); err != nil {
-		bf.Abort();
+	if err := sf.Begin(ctx); err != nil {
+		bf.Abort()
 		return err
 	}
 	defer func() {
 		sf.Cleanup()
 	}()
-	err = Transfer(os.Stdin, sf)
+	start := time.Now()
+	var src io.Reader = in
+	var counted *CountingReader
+	if Reporting(c) {
+		// Counting hides the input from kernel copies, so only when asked.
+		counted = &CountingReader{Reader: in}
+		src = counted
+		defer func() {
+			r.BytesRead = counted.N
+			r.Describe(c, existed, bf, sf)
+		}()
+	}
+	r.Stage = "transfer"
+	Notify("READY=1", "STATUS=Reading input for "+strings.Join(Targets(c), ", "))
+	err = TransferInput(ctx, c, src, sf)
+	r.Durations.Transfer = time.Since(start).Seconds()
 	if err != nil {
 		bf.Abort()
 		sf.Abort()
 		return err
 	}
+	r.Stage = "backup"
 	if err := bf.Complete(); err != nil {
 		sf.Abort()
 		return err
 	}
-	if err := sf.Complete(); err != nil {
+	r.Stage = "commit"
+	Notify("STATUS=Committing")
+	committing := time.Now()
+	err = sf.Complete(ctx)
+	r.Durations.Commit = time.Since(committing).Seconds()
+	if err != nil {
 		return err
 	}
-	return nil
-}
-
-func Transfer(in *os.File, sf SpongeFile) error {
-	var err error = nil
-	buf := make([]byte, READSIZE)
-	for err == nil {
-		n, err := in.Read(buf)
-		if n > 0 {
-			sf.Write(buf[:n])
+	r.committed = true
+	if Journaling(c) {
+		if err := JournalCommits(c, Targets(c), existed, bf, sf); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot write journal: %s\n", err)
 		}
-		if n == 0 && err == io.EOF {
-			return nil
+	}
+	if c.GlobalBool("stats") {
+		PrintStats(c, counted.N, time.Since(start), existed, bf, sf)
+	}
+	r.Stage = "finish"
+	if c.GlobalInt("backup-keep") > 0 {
+		if err := PruneBackups(c, Targets(c)); err != nil {
+			return err
 		}
-		if err != nil {
+	}
+	if c.GlobalBool("tee") {
+		if err := replay.Replay(os.Stdout); err != nil {
 			return err
 		}
 	}
-	return err
+	if c.GlobalString("post-cmd") != "" {
+		r.Stage = "post-cmd"
+		err := RunPostCommand(ctx, c.GlobalString("post-cmd"), Targets(c), TargetSponges(sf))
+		if err != nil {
+			return cli.NewExitError(err.Error(), ExitPostCmd)
+		}
+	}
+	if c.GlobalBool("skip-unchanged") {
+		if ch, ok := sf.(sponge.Changer); ok && !ch.Changed() {
+			return cli.NewExitError("Destination unchanged.", ExitUnchanged)
+		}
+	}
+	return nil
 }
 
-func OpenInput(c *cli.Context) (*os.File, error) {
-	inputFn := c.GlobalString("input")
-	if inputFn == "" {
-		return os.Stdin, nil
+// OpenInput opens the input, checking and decompressing it as asked.
+// With --no-empty or --delete-if-empty, empty input fails with
+// ErrEmptyInput, and --min-bytes and --max-bytes fail reading input of
+// the wrong size.
+func OpenInput(ctx context.Context, c *cli.Context) (io.ReadCloser, error) {
+	in, err := openInput(ctx, c)
+	if err != nil {
+		return nil, err
 	}
-	return os.Open(inputFn)
+	if RefusingEmpty(c) {
+		checked, err := RefuseEmpty(ctx, c, in)
+		if err != nil {
+			in.Close()
+			return nil, err
+		}
+		in = checked
+	}
+	if c.GlobalIsSet("min-bytes") || c.GlobalIsSet("max-bytes") {
+		// Validated by CheckSizeLimits.
+		min, max, _ := SizeLimits(c)
+		in = &verifiedInput{sponge.SizeCheckedReader(in, min, max), in}
+	}
+	return in, nil
 }
 
-// Backups perform backups of the original file.
-
-type Backup interface {
-	Begin() error
-	Abort() error
-	Complete() error
+func openInput(ctx context.Context, c *cli.Context) (io.ReadCloser, error) {
+	in, err := OpenInputFile(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if c.GlobalString("input-checksum") != "" {
+		algorithm, expected, _ := ParseInputChecksum(c.GlobalString("input-checksum"))
+		vr, err := sponge.VerifiedReader(in, algorithm, expected)
+		if err != nil {
+			in.Close()
+			return nil, err
+		}
+		in = &verifiedInput{vr, in}
+	}
+	if c.GlobalString("decompress") == "" {
+		return in, nil
+	}
+	dec, err := sponge.NewDecompressReader(in, c.GlobalString("decompress"))
+	if err != nil {
+		in.Close()
+		return nil, err
+	}
+	return &decompressedInput{dec, in}, nil
 }
 
-func GetBackup(c *cli.Context) (Backup, error) {
-	if c.GlobalString("backup") == "" {
-		return &NoBackup{}, nil
+func OpenInputFile(ctx context.Context, c *cli.Context) (io.ReadCloser, error) {
+	if c.GlobalString("exec") != "" {
+		return OpenExecInput(ctx, c)
 	}
-	return NewConcurrentBackup(c.Args().First(), c.GlobalString("backup")), nil
+	if c.GlobalIsSet("input-fd") {
+		f := InputFD(c)
+		if _, err := f.Stat(); err != nil {
+			return nil, fmt.Errorf("Cannot read from descriptor %d: %s", c.GlobalInt("input-fd"), err)
+		}
+		return f, nil
+	}
+	inputFns := c.GlobalStringSlice("input")
+	switch len(inputFns) {
+	case 0:
+		return os.Stdin, nil
+	case 1:
+		return OpenNamedInput(ctx, c, inputFns[0])
+	}
+	open := func(inputFn string) (io.ReadCloser, error) {
+		if inputFn == "-" {
+			// Stdin may be listed more than once, so it stays open.
+			return ioutil.NopCloser(os.Stdin), nil
+		}
+		return OpenNamedInput(ctx, c, inputFn)
+	}
+	return &concatInput{names: inputFns, open: open}, nil
 }
 
-type NoBackup struct {}
-
-func (c *NoBackup) Begin() error {
-	return nil
+// OpenNamedInput opens one --input, a file, a URL, or - for stdin.
+func OpenNamedInput(ctx context.Context, c *cli.Context, inputFn string) (io.ReadCloser, error) {
+	if inputFn == "-" {
+		return os.Stdin, nil
+	}
+	if sponge.IsURL(inputFn) {
+		return sponge.OpenURL(ctx, inputFn, c.GlobalInt("input-retries"))
+	}
+	return os.Open(inputFn)
 }
 
-func (c *NoBackup) Abort() error {
-	return nil
+// inputFD is the file for --input-fd, once it has been opened.
+var inputFD *os.File
+
+// InputFD returns the file for the descriptor given by --input-fd.  It
+// is only made once, since each *os.File closes its descriptor when it
+// is collected.
+func InputFD(c *cli.Context) *os.File {
+	fd := c.GlobalInt("input-fd")
+	if fd == 0 {
+		return os.Stdin
+	}
+	if inputFD == nil {
+		inputFD = os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd))
+	}
+	return inputFD
 }
 
-func (c *NoBackup) Complete() error {
-	return nil
+// ParseInputChecksum splits --input-checksum into its algorithm and hex
+// digest.
+func ParseInputChecksum(s string) (string, string, error) {
+	i := strings.Index(s, ":")
+	if i < 0 {
+		return "", "", fmt.Errorf("Invalid input checksum %q, expected ALGORITHM:HEX.", s)
+	}
+	algorithm, expected := s[:i], s[i+1:]
+	if _, err := sponge.NewChecksum(algorithm); err != nil {
+		return "", "", err
+	}
+	if _, err := hex.DecodeString(expected); err != nil || expected == "" {
+		return "", "", fmt.Errorf("Invalid input checksum %q, expected ALGORITHM:HEX.", s)
+	}
+	return algorithm, expected, nil
 }
 
-type ConcurrentBackup struct {
-	SourceFn string
-	BackupFn string
-	Done chan error
+// TransferInput copies in to sf, reporting progress, throttling it, and
+// overlapping reads and writes if asked.  With --idle-timeout it gives
+// up once no input has arrived for that long.
+func TransferInput(ctx context.Context, c *cli.Context, in io.Reader, sf sponge.SpongeFile) error {
+	return WithIdleTimeout(ctx, c, in, func(ctx context.Context, in io.Reader) error {
+		return transferInput(ctx, c, in, sf)
+	})
 }
 
-func NewConcurrentBackup(source, backup string) Backup {
-	return &ConcurrentBackup{
-		SourceFn: source,
-		BackupFn: BackupFile(backup, source),
-		Done: nil,
+// WithIdleTimeout calls read with in, cancelling its context when
+// --idle-timeout passes without any input arriving.
+func WithIdleTimeout(ctx context.Context, c *cli.Context, in io.Reader, read func(context.Context, io.Reader) error) error {
+	if !c.GlobalIsSet("idle-timeout") {
+		return read(ctx, in)
 	}
+	timeout := c.GlobalDuration("idle-timeout")
+	idle := fmt.Errorf("No input arrived for %s.", timeout)
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	in, stop := sponge.IdleReader(in, timeout, func() { cancel(idle) })
+	defer stop()
+	err := read(ctx, in)
+	if err != nil && context.Cause(ctx) == idle {
+		return idle
+	}
+	return err
 }
 
-func (cb *ConcurrentBackup) Begin() error {
-	done, err := Copy(cb.SourceFn, cb.BackupFn)
-	if err != nil {
-		return err
+func transferInput(ctx context.Context, c *cli.Context, in io.Reader, sf sponge.SpongeFile) error {
+	if c.GlobalBool("progress") {
+		total := InputSize(c)
+		if c.GlobalIsSet("size-hint") {
+			total = SizeHint(c)
+		} else if c.GlobalString("decompress") != "" {
+			total = 0
+		}
+		p := NewProgress(in, total)
+		defer p.Stop()
+		in = p
 	}
-	cb.Done = done
-	return nil
+	if c.GlobalIsSet("throttle") {
+		rate, _ := ParseSize(c.GlobalString("throttle"))
+		in = sponge.ThrottledReader(ctx, in, rate)
+	}
+	if c.GlobalBool("pipeline") {
+		return sponge.TransferPipelined(ctx, in, sf)
+	}
+	return sponge.Transfer(ctx, in, sf)
 }
 
-func (cb *ConcurrentBackup) Abort() error {
-	if cb.Done == nil {
+// SetRenameRetries sets how many times moving the data into place is
+// retried from --rename-retries.
+func SetRenameRetries(c *cli.Context) error {
+	if !c.GlobalIsSet("rename-retries") {
 		return nil
 	}
-	return <- cb.Done
+	if c.GlobalInt("rename-retries") < 0 {
+		return errors.New("--rename-retries must not be negative")
+	}
+	if c.GlobalInt("rename-retries") > sponge.MaxRenameRetries {
+		return fmt.Errorf("--rename-retries must be at most %d", sponge.MaxRenameRetries)
+	}
+	sponge.RenameRetries = c.GlobalInt("rename-retries")
+	return nil
 }
 
-func (cb *ConcurrentBackup) Complete() error {
-	if cb.Done == nil {
+// SetBufferSize sets how much input is read at a time from
+// --buffer-size, or else to suit targets' filesystems.
+func SetBufferSize(c *cli.Context, targets []string) error {
+	if !c.GlobalIsSet("buffer-size") {
+		sponge.READSIZE = DefaultBufferSize(targets)
 		return nil
 	}
-	err := <- cb.Done
+	size, err := ParseSize(c.GlobalString("buffer-size"))
 	if err != nil {
 		return err
 	}
-	fi, err := os.Stat(cb.SourceFn)
-	if err != nil {
-		return err
+	if size <= 0 {
+		return errors.New("--buffer-size must be positive")
 	}
-	return os.Chmod(cb.BackupFn, fi.Mode())
+	sponge.READSIZE = int(size)
+	return nil
 }
 
-// Sponges accumulate data before moving them into the correct location on
-// the filesystem
-
-type SpongeFile interface {
-	Begin() error
-	Abort() error
-	Write([]byte) error
-	Complete() error
-	Cleanup() error
+// DefaultBufferSize returns the largest buffer size suited to any of
+// targets.
+func DefaultBufferSize(targets []string) int {
+	size := sponge.MinBufferSize
+	for _, target := range targets {
+		if n := sponge.BufferSize(target); n > size {
+			size = n
+		}
+	}
+	return size
 }
 
-func GetSpongeFile(c *cli.Context) (SpongeFile, error) {
-	if !c.GlobalBool("memory") {
-		return NewAtomicSponge(
-			c.Args().First(),
-			c.GlobalString("tmpdir"),
-			c.GlobalBool("leave-dirty")),
-			nil
+// SizeHint returns the expected size of the data written to each
+// destination: --size-hint, or else the size of the input when it is a
+// plain file written unchanged.  It is zero when unknown.
+func SizeHint(c *cli.Context) int64 {
+	if c.GlobalIsSet("size-hint") {
+		size, _ := ParseSize(c.GlobalString("size-hint"))
+		return size
 	}
-	if c.GlobalBool("atomic") {
-		return NewAtomicMemorySponge(
-			c.Args().First(),
-			c.GlobalString("tmpdir"),
-			c.GlobalBool("leave-dirty")),
-			nil
+	transformed := c.GlobalString("decompress") != "" || c.GlobalString("compress") != "" ||
+		c.GlobalIsSet("encrypt-age") || c.GlobalIsSet("encrypt-gpg")
+	if transformed {
+		return 0
 	}
-	return NewMemorySponge(c.Args().First()), nil
+	return InputSize(c)
 }
 
-type MemorySponge struct {
-	TargetFn string
-	Data     []byte
+// InputSize returns the size of the input if it is made of plain files,
+// and otherwise zero.
+func InputSize(c *cli.Context) int64 {
+	if c.GlobalString("exec") != "" {
+		return 0
+	}
+	if c.GlobalIsSet("input-fd") {
+		size, _ := fileSize(InputFD(c).Stat())
+		return size
+	}
+	inputFns := c.GlobalStringSlice("input")
+	if len(inputFns) == 0 {
+		size, _ := fileSize(os.Stdin.Stat())
+		return size
+	}
+	total := int64(0)
+	stdin := false
+	for _, inputFn := range inputFns {
+		// Stdin is used up the first time it is read.
+		if inputFn == "-" && stdin {
+			continue
+		}
+		var size int64
+		var ok bool
+		if inputFn == "-" {
+			size, ok = fileSize(os.Stdin.Stat())
+			stdin = true
+		} else {
+			size, ok = fileSize(os.Stat(inputFn))
+		}
+		if !ok {
+			return 0
+		}
+		total += size
+	}
+	return total
 }
 
-func NewMemorySponge(Target string) SpongeFile {
-	return &MemorySponge{
-		TargetFn: Target,
-		Data: make([]byte, 0, READSIZE),
+// Returns the size of a plain file, or false for anything else.
+func fileSize(fi os.FileInfo, err error) (int64, bool) {
+	if err != nil || !fi.Mode().IsRegular() {
+		return 0, false
 	}
+	return fi.Size(), true
 }
 
-func (ms *MemorySponge) Begin() error {
-	return nil
+// verifiedInput checks the input as it is read, and closes it.
+type verifiedInput struct {
+	io.Reader
+	io.Closer
 }
 
-func (ms *MemorySponge) Abort() error {
-	return nil
+// decompressedInput closes both the decompressor and the underlying
+// input.
+type decompressedInput struct {
+	io.ReadCloser
+	file io.Closer
 }
 
-func (ms *MemorySponge) Write(d []byte) error {
-	ms.Data = append(ms.Data, d...)
-	return nil
+func (di *decompressedInput) Close() error {
+	di.ReadCloser.Close()
+	return di.file.Close()
 }
 
-func (ms *MemorySponge) Complete() error {
-	fi, err := os.Stat(ms.TargetFn)
-	if err != nil && !os.IsNotExist(err) {
-		return err
+// BackupTemplate returns the backup filename template, or "" if there
+// are no backups.
+func BackupTemplate(c *cli.Context) string {
+	if c.GlobalString("backup") != "" {
+		return c.GlobalString("backup")
 	}
-	mode := DEFAULT_MODE
-	if err != nil {
-		mode = fi.Mode()
+	if c.GlobalString("backup-dir") != "" {
+		return "{base}"
 	}
-	err = ioutil.WriteFile(ms.TargetFn, ms.Data, mode)
-	if err != nil {
-		return err
+	if c.GlobalBool("backup-numbered") {
+		return "{file}"
 	}
-	return nil
-}
-
-func (ms *MemorySponge) Cleanup() error {
-	return nil
+	return ""
 }
 
-type AtomicSponge struct {
-	SpongeFn   string
-	TempDir    string
-	TargetFn   string
-	Sponge     *os.File
-	LeaveDirty bool
+func GetBackupOptions(c *cli.Context) sponge.BackupOptions {
+	return sponge.BackupOptions{
+		Numbered: c.GlobalBool("backup-numbered"),
+		Dir:      c.GlobalString("backup-dir"),
+		InPlace:  c.GlobalBool("in-place") || c.GlobalBool("memory") && !c.GlobalBool("atomic"),
+	}
 }
 
-var DEFAULT_MODE os.FileMode = 0600
-
-func TempDir(tempDir, targetFn string) string {
-	if tempDir == "" {
-		return path.Dir(targetFn)
+func GetBackup(c *cli.Context) (sponge.Backup, error) {
+	template := BackupTemplate(c)
+	if template == "" {
+		return &sponge.NoBackup{}, nil
+	}
+	opts := GetBackupOptions(c)
+	if len(Targets(c)) == 1 {
+		return sponge.NewBackup(Targets(c)[0], template, opts)
 	}
-	tempDir = strings.Replace(tempDir, "{dir}", path.Dir(targetFn), -1)
-	return strings.Replace(tempDir, "{base}", path.Base(targetFn), -1)
+	backups := []sponge.Backup{}
+	backupFns := map[string]string{}
+	for _, target := range Targets(c) {
+		bf, err := sponge.NewBackup(target, template, opts)
+		if err != nil {
+			return nil, err
+		}
+		backupFn := bf.(*sponge.ConcurrentBackup).BackupFn
+		if other, ok := backupFns[backupFn]; ok && !c.GlobalBool("backup-numbered") {
+			return nil, fmt.Errorf("Backups of %s and %s would both go to %s.", other, target, backupFn)
+		}
+		backupFns[backupFn] = target
+		backups = append(backups, bf)
+	}
+	return sponge.NewMultiBackup(backups...), nil
 }
 
-func BackupFile(backupFile, targetFn string) string {
-	backupFile = strings.Replace(backupFile, "{dir}", path.Dir(targetFn), -1)
-	backupFile = strings.Replace(backupFile, "{base}", path.Base(targetFn), -1)
-	return strings.Replace(backupFile, "{file}", targetFn, -1)
+func GetSpongeFile(c *cli.Context) (sponge.SpongeFile, error) {
+	if len(Targets(c)) == 1 {
+		return GetTargetSpongeFile(c, Targets(c)[0])
+	}
+	sponges := []sponge.SpongeFile{}
+	for _, target := range Targets(c) {
+		sf, err := GetTargetSpongeFile(c, target)
+		if err != nil {
+			return nil, err
+		}
+		sponges = append(sponges, sf)
+	}
+	return sponge.NewMultiSponge(sponges...), nil
 }
 
-func NewAtomicSponge(targetFn, tempDir string, leaveDirty bool) SpongeFile {
-	return &AtomicSponge{
-		TargetFn: targetFn,
-		TempDir: TempDir(tempDir, targetFn),
-		LeaveDirty: leaveDirty,
+func PruneBackups(c *cli.Context, targets []string) error {
+	for _, target := range targets {
+		pattern, err := BackupPattern(c, target)
+		if err != nil {
+			return err
+		}
+		if err := sponge.PruneBackups(pattern, target, c.GlobalInt("backup-keep")); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func (ms *AtomicSponge) Begin() error {
-	sponge, err := ioutil.TempFile(ms.TempDir, ".sponge")
+// BackupPattern returns a glob matching the backups of target made with
+// the current backup options.
+func BackupPattern(c *cli.Context, target string) (string, error) {
+	template, err := sponge.BackupTemplate(BackupTemplate(c), target, GetBackupOptions(c))
 	if err != nil {
-		return err
+		return "", err
 	}
-	ms.Sponge = sponge
-	ms.SpongeFn = sponge.Name()
-	return nil
+	pattern := sponge.BackupPattern(template, target)
+	if c.GlobalBool("backup-numbered") {
+		pattern = sponge.NumberedBackupPattern(pattern)
+	}
+	return pattern, nil
 }
 
-func (ms *AtomicSponge) Abort() error {
-	return nil
+// TargetSponges returns the sponge for each destination.
+func TargetSponges(sf sponge.SpongeFile) []sponge.SpongeFile {
+	if ms, ok := sf.(*sponge.MultiSponge); ok {
+		return ms.Sponges
+	}
+	return []sponge.SpongeFile{sf}
 }
 
-func (ms *AtomicSponge) Write(d []byte) error {
-	n, err := ms.Sponge.Write(d)
-	if err != nil {
-		return err
+func GetTargetSpongeFile(c *cli.Context, target string) (sponge.SpongeFile, error) {
+	opts := GetOptions(c)
+	if c.GlobalBool("diff") {
+		opts.Verify = VerifyHooks(opts.Verify, DiffHook(target))
 	}
-	if err == nil && n < len(d) {
-		return io.ErrShortWrite
+	if c.GlobalBool("confirm") {
+		opts.Verify = VerifyHooks(opts.Verify, ConfirmHook(target))
 	}
-	return nil
+	if err := GuardTarget(c, target, &opts); err != nil {
+		return nil, err
+	}
+	sf, err := GetStorageSponge(c, target, opts)
+	if err != nil {
+		return nil, err
+	}
+	return DecorateSponge(c, target, sf, opts)
 }
 
-func (ms *AtomicSponge) Complete() error {
-	err := ms.Sponge.Close()
-	ms.Sponge = nil
-	if err != nil {
-		return err
+// DecorateSponge wraps the storage sponge sf with the requested
+// checksums, encryption, and compression.  Dry runs skip the checksum
+// sidecar.
+func DecorateSponge(c *cli.Context, target string, sf sponge.SpongeFile, opts sponge.Options) (sponge.SpongeFile, error) {
+	var err error
+	if c.GlobalString("checksum") != "" && !c.GlobalBool("dry-run") {
+		sf, err = sponge.NewChecksumSponge(sf, target, c.GlobalString("checksum"), opts)
+		if err != nil {
+			return nil, err
+		}
 	}
-	fi, err := os.Stat(ms.TargetFn)
-	if err != nil && !os.IsNotExist(err) {
-		return err
+	if len(c.GlobalStringSlice("encrypt-age")) > 0 {
+		recipients := []age.Recipient{}
+		for _, s := range c.GlobalStringSlice("encrypt-age") {
+			r, err := sponge.ParseAgeRecipient(s)
+			if err != nil {
+				return nil, err
+			}
+			recipients = append(recipients, r)
+		}
+		sf = sponge.NewAgeSponge(sf, recipients)
 	}
-	if err == nil {
-		if err := os.Chmod(ms.SpongeFn, fi.Mode()); err != nil {
+	if len(c.GlobalStringSlice("encrypt-gpg")) > 0 {
+		recipients, err := GetGPGRecipients(c)
+		if err != nil {
+			return nil, err
 		}
-
+		sf = sponge.NewGPGSponge(sf, recipients, c.GlobalBool("armor"))
 	}
-	if err := os.Rename(ms.SpongeFn, ms.TargetFn); err != nil {
-		return err
+	if c.GlobalString("compress") != "" {
+		codec, err := sponge.GetCodec(c.GlobalString("compress"))
+		if err != nil {
+			return nil, err
+		}
+		level := sponge.DefaultLevel
+		if c.GlobalIsSet("compress-level") {
+			level = c.GlobalInt("compress-level")
+		}
+		sf = sponge.NewCompressSponge(sf, codec, level)
 	}
-	return nil
+	return sf, nil
 }
 
-func (ms *AtomicSponge) Cleanup() error {
-	if ms.LeaveDirty {
-		return nil
+func GetGPGRecipients(c *cli.Context) ([]*openpgp.Entity, error) {
+	keyringFn := c.GlobalString("gpg-keyring")
+	if keyringFn == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		keyringFn = filepath.Join(home, ".gnupg", "pubring.gpg")
 	}
-	if _, err := os.Stat(ms.SpongeFn); os.IsNotExist(err) {
-		return nil
+	keyring, err := sponge.LoadKeyring(keyringFn)
+	if err != nil {
+		return nil, err
 	}
-	if err := os.Remove(ms.SpongeFn); err != nil {
-		return err
+	recipients := []*openpgp.Entity{}
+	for _, id := range c.GlobalStringSlice("encrypt-gpg") {
+		e, err := sponge.FindGPGRecipient(keyring, id)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, e)
 	}
-	return nil
+	return recipients, nil
 }
 
+func GetOptions(c *cli.Context) sponge.Options {
+	opts := sponge.Options{
+		TempDir:    c.GlobalString("tmpdir"),
+		TempName:   c.GlobalString("tmpname"),
+		LeaveDirty: c.GlobalBool("leave-dirty"),
+		Append:     c.GlobalBool("append"),
+		Fsync:      c.GlobalBool("fsync"),
+		NoClobber:  c.GlobalBool("no-clobber"),
+		CheckSpace: c.GlobalBool("check-space"),
 
-type AtomicMemorySponge struct {
-	Writer SpongeFile
-	Data []byte
-}
-
-func NewAtomicMemorySponge(targetFn, tmpDir string, leaveDirty bool) SpongeFile {
-	return &AtomicMemorySponge{
-		Writer: NewAtomicSponge(targetFn, tmpDir, leaveDirty),
-		Data: make([]byte, 0, READSIZE),
+		SkipUnchanged: c.GlobalBool("skip-unchanged"),
+		Sparse:        c.GlobalBool("sparse"),
+		SizeHint:      SizeHint(c),
+		Direct:        c.GlobalBool("direct"),
+		URing:         c.GlobalString("backend") == "iouring",
+		Warn: func(msg string) {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", msg)
+		},
 	}
-}
-
-func (ams *AtomicMemorySponge) Begin() error {
-	return nil
-}
-
-func (ams *AtomicMemorySponge) Write(d []byte) error {
-	ams.Data = append(ams.Data, d...)
-	return nil
-}
-
-func (ams *AtomicMemorySponge) Abort() error {
-	return ams.Writer.Abort()
-}
-
-func (ams *AtomicMemorySponge) Complete() error {
-	if err := ams.Writer.Begin(); err != nil {
-		return err
+	if c.GlobalString("verify-cmd") != "" {
+		opts.Verify = VerifyCommand(c.GlobalString("verify-cmd"))
 	}
-	if err := ams.Writer.Write(ams.Data); err != nil {
-		return err
+	if c.GlobalString("mode") != "" {
+		// Validated in Sponge.
+		opts.Mode, _ = sponge.ParseMode(c.GlobalString("mode"))
 	}
-	return ams.Writer.Complete()
-}
-
-func (ams *AtomicMemorySponge) Cleanup() error {
-	return ams.Writer.Cleanup()
+	// The reference goes first so that explicit settings override it.
+	if c.GlobalString("reference") != "" {
+		refMode, refMetadata, _ := sponge.Reference(c.GlobalString("reference"))
+		opts.Mode = ThenMode(refMode, opts.Mode)
+		opts.Metadata = append(opts.Metadata, refMetadata)
+	}
+	preserve, _ := GetPreserve(c)
+	opts.Metadata = append(opts.Metadata, preserve...)
+	if chown, _ := GetChown(c); chown != nil {
+		opts.Metadata = append(opts.Metadata, chown)
+	}
+	return opts
 }
 
-func Copy(src, dest string) (chan error, error) {
-	if src == dest {
-		return nil, errors.New("Will not copy to same filename.")
+// GetStorageSponge chooses how data is accumulated for target.  With
+// --follow-symlinks a symlinked target is written through its links.
+func GetStorageSponge(c *cli.Context, target string, opts sponge.Options) (sponge.SpongeFile, error) {
+	if target == sponge.StdoutTarget {
+		up := sponge.WriterUploader{W: os.Stdout}
+		return sponge.NewRemoteSponge(target, up, c.GlobalBool("memory"), opts), nil
 	}
-	sfi, err := os.Stat(src)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
-		} else {
+	if sponge.IsRemote(target) {
+		up, err := sponge.NewUploader(target, opts)
+		if err != nil {
 			return nil, err
 		}
+		return sponge.NewRemoteSponge(target, up, c.GlobalBool("memory"), opts), nil
 	}
-	if !sfi.Mode().IsRegular() {
-		return nil, fmt.Errorf("Cannot copy non-regular source file %s (%q)", src, sfi.Mode().String())
-	}
-	dfi, err := os.Stat(dest)
-	if err != nil && !os.IsNotExist(err) {
-		return nil, err
+	if archiveFn, member, ok := sponge.SplitMember(target); ok {
+		if c.GlobalBool("follow-symlinks") {
+			var err error
+			if archiveFn, err = sponge.FollowSymlinks(archiveFn); err != nil {
+				return nil, err
+			}
+		}
+		return sponge.NewMemberSponge(archiveFn, member, opts)
 	}
-	if err == nil && !dfi.Mode().IsRegular() {
-		return nil, fmt.Errorf("Cannot copy to non-regular destination %s (%q)", dest, dfi.Mode().String())
+	if c.GlobalBool("follow-symlinks") {
+		var err error
+		if target, err = sponge.FollowSymlinks(target); err != nil {
+			return nil, err
+		}
 	}
-	if os.SameFile(sfi, dfi) {
-		return nil, nil
+	if c.GlobalBool("in-place") {
+		return sponge.NewInPlaceSponge(target, opts), nil
 	}
-	if err = os.Link(src, dest); err == nil {
-		return nil, nil
+	if c.GlobalIsSet("max-memory") {
+		maxMemory, err := ParseSize(c.GlobalString("max-memory"))
+		if err != nil {
+			return nil, err
+		}
+		return sponge.NewHybridSponge(target, int(maxMemory), opts), nil
 	}
-	source, err := os.Open(src)
-	if err != nil {
-		return nil, err
+	if c.GlobalBool("memfd") {
+		return sponge.NewMemfdSponge(target, opts), nil
 	}
-
-	backup, err := os.Create(dest)
-	if err != nil {
-		source.Close()
-		return nil, err
+	if !c.GlobalBool("memory") {
+		return sponge.NewAtomicSponge(target, opts), nil
 	}
-	done := make(chan error)
-	go DoConcurrentCopy(source, backup, done)
-	return done, nil
-}
-
-func DoConcurrentCopy(source, dest *os.File, done chan error) {
-	defer source.Close()
-	defer dest.Close()
-	_, err := io.Copy(dest, source)
-	if err != nil {
-		done <- err
+	if c.GlobalBool("atomic") {
+		return sponge.NewAtomicMemorySponge(target, opts), nil
 	}
-	close(done)
+	return sponge.NewMemorySponge(target, opts), nil
 }
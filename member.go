@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/jmyounker/spunge/pkg/sponge"
+	"github.com/urfave/cli"
+)
+
+// memberConflicts make no sense for archive members, whose archive is
+// rewritten through a tempfile, and which are not files themselves.
+var memberConflicts = []string{
+	"backup", "backup-numbered", "backup-dir", "backup-keep", "journal",
+	"atomic", "memory", "max-memory", "memfd", "append", "direct", "backend",
+	"sparse", "dry-run", "diff", "confirm", "checksum", "no-clobber",
+	"exchange", "in-place", "delete-if-empty",
+}
+
+// CheckMemberTargets checks that any archive member destinations, like
+// archive.tar::path/inside, are valid, and that no options which cannot
+// apply to them are given.
+func CheckMemberTargets(c *cli.Context, targets []string) error {
+	member := false
+	for _, target := range targets {
+		archiveFn, name, ok := sponge.SplitMember(target)
+		if !ok || sponge.IsRemote(target) {
+			continue
+		}
+		if _, err := sponge.NewMemberSponge(archiveFn, name, sponge.Options{}); err != nil {
+			return err
+		}
+		member = true
+	}
+	if !member {
+		return nil
+	}
+	return RefuseFlags(c, memberConflicts, "an archive member")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/urfave/cli"
+)
+
+// MetricsJob is the Pushgateway job under which runs are grouped, by
+// their first destination.
+var MetricsJob = "spunge"
+
+// PushMetrics pushes metrics describing r to the Pushgateway at url,
+// replacing those from the last run with the same first destination.
+func PushMetrics(c *cli.Context, url string, r *Report) error {
+	bytesRead := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "spunge_bytes_read_total",
+		Help: "Bytes of input sponged.",
+	})
+	durations := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "spunge_duration_seconds",
+		Help:    "Time spent transferring, committing, and in total.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 12),
+	}, []string{"stage"})
+	failures := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "spunge_failures_total",
+		Help: "Failed runs, by the stage which failed.",
+	}, []string{"stage"})
+	destinations := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "spunge_destinations_total",
+		Help: "Destinations, by outcome.",
+	}, []string{"outcome"})
+	lastRun := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "spunge_last_run_timestamp_seconds",
+		Help: "When the run finished.",
+	})
+	lastSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "spunge_last_run_success",
+		Help: "1 if the run succeeded, and otherwise 0.",
+	})
+
+	bytesRead.Add(float64(r.BytesRead))
+	durations.WithLabelValues("transfer").Observe(r.Durations.Transfer)
+	durations.WithLabelValues("commit").Observe(r.Durations.Commit)
+	durations.WithLabelValues("total").Observe(r.Durations.Total)
+	if r.Outcome == "failed" || r.Error != "" {
+		failures.WithLabelValues(r.Stage).Inc()
+	} else {
+		lastSuccess.Set(1)
+	}
+	for _, t := range r.Targets {
+		destinations.WithLabelValues(t.Outcome).Inc()
+	}
+	lastRun.SetToCurrentTime()
+
+	destination := ""
+	if targets := Targets(c); len(targets) > 0 {
+		destination = targets[0]
+	}
+	if abs, err := filepath.Abs(destination); err == nil {
+		destination = abs
+	}
+	return push.New(url, MetricsJob).
+		Grouping("destination", destination).
+		Collector(bytesRead).
+		Collector(durations).
+		Collector(failures).
+		Collector(destinations).
+		Collector(lastRun).
+		Collector(lastSuccess).
+		Push()
+}
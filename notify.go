@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+)
+
+// Notify sends states such as "READY=1" or "STATUS=..." to systemd when
+// running under it with NOTIFY_SOCKET set, and otherwise does nothing.
+// Failures are only warnings.
+func Notify(states ...string) {
+	if _, err := daemon.SdNotify(false, strings.Join(states, "\n")); err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot notify systemd: %s\n", err)
+	}
+}
+
+// StartWatchdog pings systemd's watchdog at half its interval, if the
+// unit has WatchdogSec set, until the returned function is called.
+func StartWatchdog() func() {
+	interval, err := daemon.SdWatchdogEnabled(false)
+	if err != nil || interval == 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				Notify(daemon.SdNotifyWatchdog)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
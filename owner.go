@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+
+	"github.com/jmyounker/spunge/pkg/sponge"
+	"github.com/urfave/cli"
+)
+
+// LookupUid resolves a user name or numeric uid.
+func LookupUid(name string) (int, error) {
+	if uid, err := strconv.Atoi(name); err == nil {
+		return uid, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, fmt.Errorf("Unknown owner %s.", name)
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+// LookupGid resolves a group name or numeric gid.
+func LookupGid(name string) (int, error) {
+	if gid, err := strconv.Atoi(name); err == nil {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, fmt.Errorf("Unknown group %s.", name)
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// ThenMode applies first and then next, if set.
+func ThenMode(first, next sponge.ModeFunc) sponge.ModeFunc {
+	if next == nil {
+		return first
+	}
+	return func(current os.FileMode) os.FileMode {
+		return next(first(current))
+	}
+}
+
+// GetChown returns the metadata setting the requested --owner and
+// --group, or nil if neither was given.  The one not given comes from
+// --reference, if set.
+func GetChown(c *cli.Context) (sponge.MetadataFunc, error) {
+	if c.GlobalString("owner") == "" && c.GlobalString("group") == "" {
+		return nil, nil
+	}
+	uid, gid := -1, -1
+	if c.GlobalString("reference") != "" {
+		if fi, err := os.Stat(c.GlobalString("reference")); err == nil {
+			if u, g, ok := sponge.FileOwner(fi); ok {
+				uid, gid = u, g
+			}
+		}
+	}
+	var err error
+	if c.GlobalString("owner") != "" {
+		if uid, err = LookupUid(c.GlobalString("owner")); err != nil {
+			return nil, err
+		}
+	}
+	if c.GlobalString("group") != "" {
+		if gid, err = LookupGid(c.GlobalString("group")); err != nil {
+			return nil, err
+		}
+	}
+	return sponge.Chown(uid, gid), nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/jmyounker/spunge/pkg/sponge"
+	"github.com/urfave/cli"
+)
+
+// CheckParents checks the mode given by --parents-mode.
+func CheckParents(c *cli.Context) error {
+	if !c.GlobalIsSet("parents-mode") {
+		return nil
+	}
+	if !c.GlobalBool("parents") {
+		return errors.New("--parents-mode makes no sense without --parents")
+	}
+	_, err := sponge.ParseMode(c.GlobalString("parents-mode"))
+	return err
+}
+
+// MakeParents creates the missing directories above each of the local
+// targets when --parents asks for them.  An archive member's are above
+// its archive.
+func MakeParents(c *cli.Context, targets []string) error {
+	if !c.GlobalBool("parents") {
+		return nil
+	}
+	var mode sponge.ModeFunc
+	if c.GlobalIsSet("parents-mode") {
+		// Validated by CheckParents.
+		mode, _ = sponge.ParseMode(c.GlobalString("parents-mode"))
+	}
+	for _, target := range targets {
+		if sponge.IsRemote(target) || target == sponge.StdoutTarget {
+			continue
+		}
+		if archiveFn, _, ok := sponge.SplitMember(target); ok {
+			target = archiveFn
+		}
+		if c.GlobalBool("no-follow") {
+			// Never create directories somewhere a symlink points.
+			if err := CheckNoSymlinks(c, target); err != nil {
+				return err
+			}
+		}
+		if err := sponge.MakeParents(target, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
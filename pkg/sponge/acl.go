@@ -0,0 +1,9 @@
+package sponge
+
+// ACLXattrs are the extended attributes holding POSIX ACLs on Linux.
+var ACLXattrs = []string{"system.posix_acl_access", "system.posix_acl_default"}
+
+// CopyACLs returns a MetadataFunc which copies the target's POSIX ACLs.
+func CopyACLs() MetadataFunc {
+	return CopyXattrs(ACLXattrs...)
+}
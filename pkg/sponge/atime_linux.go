@@ -0,0 +1,16 @@
+package sponge
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// Returns fi's access time.
+func fileAtime(fi os.FileInfo) time.Time {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fi.ModTime()
+	}
+	return time.Unix(int64(st.Atim.Sec), int64(st.Atim.Nsec))
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package sponge
+
+import (
+	"os"
+	"time"
+)
+
+// Access times are not available here, so the modification time stands
+// in for them.
+func fileAtime(fi os.FileInfo) time.Time {
+	return fi.ModTime()
+}
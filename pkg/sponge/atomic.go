@@ -0,0 +1,456 @@
+package sponge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+)
+
+// AtomicSponge writes data to a scratch file as it arrives and then
+// renames the scratch file over the target.
+type AtomicSponge struct {
+	SpongeFn   string
+	TempDir    string
+	TempName   string
+	TargetFn   string
+	Sponge     *os.File
+	LeaveDirty bool
+	Append     bool
+	Fsync      bool
+	// SkipUnchanged leaves identical targets alone, and Unchanged
+	// records that this happened.
+	SkipUnchanged bool
+	Unchanged     bool
+	Verify        func(ctx context.Context, fn string) error
+	Precondition  func() error
+	NoClobber     bool
+	ExchangeFn    string
+	CheckSpace    bool
+	FallbackFn    string
+	Warn          func(msg string)
+	Mode          ModeFunc
+	Metadata      []MetadataFunc
+	// DataOffset is where the new data begins in the sponge.  It is
+	// non-zero when appending.
+	DataOffset int64
+	// Sparse sponges leave holes instead of writing blocks of zeros.
+	Sparse   bool
+	offset   int64
+	SizeHint int64
+	// Direct sponges bypass the page cache where possible.
+	Direct bool
+	// URing sponges write through io_uring where possible.
+	URing  bool
+	writer flushWriter
+	// Unnamed sponges are created with O_TMPFILE where possible, so that
+	// nothing is left behind after a crash.  They only get a name just
+	// before replacing the target.
+	Unnamed bool
+	// opts are kept for saving the data in FallbackFn.
+	opts Options
+}
+
+// NewAtomicSponge returns a sponge which replaces targetFn atomically.
+func NewAtomicSponge(targetFn string, opts Options) SpongeFile {
+	return &AtomicSponge{
+		TargetFn:   targetFn,
+		TempDir:    TempDir(opts.TempDir, targetFn),
+		TempName:   opts.TempName,
+		LeaveDirty: opts.LeaveDirty,
+		Append:     opts.Append,
+		Fsync:      opts.Fsync,
+
+		SkipUnchanged: opts.SkipUnchanged,
+		Verify:        opts.Verify,
+		Precondition:  opts.Precondition,
+		NoClobber:     opts.NoClobber,
+		ExchangeFn:    opts.ExchangeFn,
+		CheckSpace:    opts.CheckSpace,
+		FallbackFn:    opts.FallbackFn,
+		Warn:          opts.Warn,
+		Mode:          opts.Mode,
+		Metadata:      opts.Metadata,
+		Sparse:        opts.Sparse,
+		SizeHint:      opts.SizeHint,
+		Direct:        opts.Direct,
+		URing:         opts.URing,
+		opts:          opts,
+	}
+}
+
+// hintSize tells sf, if it is an AtomicSponge, exactly how much data is
+// coming, so that Begin checks for room for it and reserves it.
+func hintSize(sf SpongeFile, size int64) {
+	if ms, ok := sf.(*AtomicSponge); ok {
+		ms.SizeHint = size
+	}
+}
+
+// flushWriter gathers writes to the sponge, and Flush finishes them.
+type flushWriter interface {
+	io.Writer
+	Flush() error
+}
+
+func (ms *AtomicSponge) Begin(ctx context.Context) error {
+	if ms.CheckSpace {
+		if err := CheckSpace(ms.TempDir, ms.SizeHint); err != nil {
+			return err
+		}
+	}
+	sponge, err := ms.createSponge()
+	if readOnly(err) && ms.FallbackFn != "" {
+		// The data is gathered beside the fallback, in case it ends up
+		// there.
+		ms.TempDir = path.Dir(ms.FallbackFn)
+		sponge, err = ms.createSponge()
+	}
+	if err != nil {
+		return err
+	}
+	ms.Sponge = sponge
+	ms.SpongeFn = sponge.Name()
+	if ms.Append {
+		if err := ms.copyTarget(ctx); err != nil {
+			return err
+		}
+	}
+	// Holes would be filled by preallocating.
+	if ms.SizeHint > 0 && !ms.Sparse {
+		if err := preallocate(ms.Sponge, ms.DataOffset+ms.SizeHint); err != nil {
+			return err
+		}
+	}
+	// Without support for either, sponges fall back to plain writes.
+	if ms.Direct && !ms.Sparse {
+		if dw, err := newDirectWriter(ms.Sponge, ms.DataOffset); err == nil {
+			ms.writer = dw
+		}
+	}
+	if ms.URing && !ms.Sparse && ms.writer == nil {
+		if uw, err := newURingWriter(ms.Sponge, ms.DataOffset); err == nil {
+			ms.writer = uw
+		}
+	}
+	return nil
+}
+
+// Creates an unnamed sponge if possible, and otherwise one named by
+// TempName.  A dirty sponge must be left behind, so it always has a name.
+func (ms *AtomicSponge) createSponge() (*os.File, error) {
+	if !ms.LeaveDirty {
+		if sponge, err := openTmpFile(ms.TempDir); err == nil {
+			ms.Unnamed = true
+			return sponge, nil
+		}
+	}
+	return createTemp(ms.TempDir, ms.TempName)
+}
+
+// In append mode the sponge starts out with the target's current contents.
+func (ms *AtomicSponge) copyTarget(ctx context.Context) error {
+	target, err := os.Open(ms.TargetFn)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+	ms.DataOffset, err = copyFile(ctx, target, ms.Sponge)
+	ms.offset = ms.DataOffset
+	return err
+}
+
+func (ms *AtomicSponge) Abort() error {
+	return nil
+}
+
+func (ms *AtomicSponge) Write(d []byte) error {
+	if ms.Sparse {
+		var err error
+		ms.offset, err = writeSparse(ms.Sponge, d, ms.offset)
+		return err
+	}
+	if ms.writer != nil {
+		_, err := ms.writer.Write(d)
+		return err
+	}
+	n, err := ms.Sponge.Write(d)
+	if err != nil {
+		return err
+	}
+	if err == nil && n < len(d) {
+		return io.ErrShortWrite
+	}
+	return nil
+}
+
+// ReadFrom copies r into the sponge, letting the kernel copy from files
+// where it can.
+func (ms *AtomicSponge) ReadFrom(r io.Reader) (int64, error) {
+	// Sparse and gathered writes need the data in hand.
+	if fileSource(r) && !ms.Sparse && ms.writer == nil {
+		return ms.Sponge.ReadFrom(r)
+	}
+	return copyBuffered(spongeWriter{ms}, r)
+}
+
+func (ms *AtomicSponge) Complete(ctx context.Context) error {
+	if ms.writer != nil {
+		err := ms.writer.Flush()
+		ms.writer = nil
+		if err != nil {
+			return err
+		}
+	}
+	if ms.Sparse {
+		// A trailing hole needs the size set explicitly.
+		if err := ms.Sponge.Truncate(ms.offset); err != nil {
+			return err
+		}
+	} else if ms.SizeHint > 0 {
+		// Storage reserved beyond the data is given back.
+		end, err := ms.Sponge.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		if err := ms.Sponge.Truncate(end); err != nil {
+			return err
+		}
+	}
+	if ms.Fsync {
+		if err := ms.Sponge.Sync(); err != nil {
+			ms.Sponge.Close()
+			ms.Sponge = nil
+			return err
+		}
+	}
+	// Closing an unnamed sponge would discard it.
+	if !ms.Unnamed {
+		err := ms.Sponge.Close()
+		ms.Sponge = nil
+		if err != nil {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if ms.Verify != nil {
+		if err := ms.Verify(ctx, ms.SpongeFn); err != nil {
+			return err
+		}
+	}
+	if ms.SkipUnchanged {
+		same, err := SameFileContents(ms.SpongeFn, ms.TargetFn)
+		if err != nil {
+			return err
+		}
+		if same {
+			ms.Unchanged = true
+			return nil
+		}
+	}
+	fi, err := os.Stat(ms.TargetFn)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := ms.setMetadata(fi); err != nil {
+		return err
+	}
+	if ms.Unnamed {
+		if err := ms.nameSponge(); err != nil {
+			return err
+		}
+	}
+	err = ms.commit(ctx)
+	if crossDevice(err) {
+		// A temp directory on another filesystem can't be renamed from,
+		// so the data is copied beside the target and renamed from there.
+		if err = ms.relocate(ctx, fi); err == nil {
+			err = ms.commit(ctx)
+		}
+	}
+	if readOnly(err) && ms.FallbackFn != "" {
+		return ms.saveFallback(ctx, err)
+	}
+	if err != nil {
+		return err
+	}
+	if ms.Fsync {
+		return SyncDir(path.Dir(ms.TargetFn))
+	}
+	return nil
+}
+
+// Gives the sponge the target's metadata, where fi describes the target
+// if it exists, and the requested mode.
+func (ms *AtomicSponge) setMetadata(fi os.FileInfo) error {
+	// Changing the owner or ACLs changes the mode, so they go first.
+	metadata := append(keptMetadata(), ms.Metadata...)
+	if err := applyMetadata(metadata, ms.SpongeFn, ms.TargetFn, fi); err != nil {
+		return err
+	}
+	if fi != nil {
+		// Keeping the mode is best effort, but a requested mode is not.
+		if err := os.Chmod(ms.SpongeFn, newMode(fi.Mode(), ms.Mode)); err != nil && ms.Mode != nil {
+			return err
+		}
+	} else if ms.Mode != nil {
+		if err := os.Chmod(ms.SpongeFn, newMode(DEFAULT_MODE, ms.Mode)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checks the precondition, and then moves the sponge into place.
+func (ms *AtomicSponge) commit(ctx context.Context) error {
+	if ms.Precondition != nil {
+		if err := ms.Precondition(); err != nil {
+			return err
+		}
+	}
+	if ms.ExchangeFn != "" {
+		return ms.exchange(ctx)
+	}
+	move := replaceFile
+	if ms.NoClobber {
+		move = createFile
+	}
+	return move(ctx, ms.SpongeFn, ms.TargetFn)
+}
+
+// Saves the sponge in FallbackFn, since err shows the target can't be
+// written.
+func (ms *AtomicSponge) saveFallback(ctx context.Context, err error) error {
+	f, ferr := os.Open(ms.SpongeFn)
+	if ferr != nil {
+		return err
+	}
+	defer f.Close()
+	return saveFallback(ctx, ms.TargetFn, ms.opts, f, err)
+}
+
+// Copies the sponge to a new scratch file beside the target, which
+// becomes the sponge, flushing it to storage so the rename can't expose
+// a partial copy.
+func (ms *AtomicSponge) relocate(ctx context.Context, fi os.FileInfo) error {
+	src, err := os.Open(ms.SpongeFn)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if ms.CheckSpace {
+		sfi, err := src.Stat()
+		if err != nil {
+			return err
+		}
+		if err := CheckSpace(path.Dir(ms.TargetFn), sfi.Size()); err != nil {
+			return err
+		}
+	}
+	dst, err := createTemp(path.Dir(ms.TargetFn), ms.TempName)
+	if err != nil {
+		return err
+	}
+	_, err = copyFile(ctx, src, dst)
+	if err == nil {
+		err = dst.Sync()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		removeFile(dst.Name())
+		return err
+	}
+	if !ms.LeaveDirty {
+		removeFile(ms.SpongeFn)
+	}
+	ms.SpongeFn = dst.Name()
+	if ms.Warn != nil {
+		ms.Warn(fmt.Sprintf("%s is not on the same filesystem as %s, so the data was copied beside it before being renamed, and a crash could leave the copy behind.", ms.TempDir, ms.TargetFn))
+	}
+	return ms.setMetadata(fi)
+}
+
+// Swaps the sponge with the target, and then moves the target's old
+// contents, now in the sponge, to ExchangeFn.
+func (ms *AtomicSponge) exchange(ctx context.Context) error {
+	swapped, err := exchangeFile(ctx, ms.SpongeFn, ms.TargetFn, ms.ExchangeFn)
+	if err != nil || !swapped {
+		return err
+	}
+	oldFn := ms.SpongeFn
+	// The old contents must not be cleaned up, even if they can't be moved.
+	ms.SpongeFn = ""
+	if err := replaceFile(ctx, oldFn, ms.ExchangeFn); err != nil {
+		return fmt.Errorf("The old contents of %s are in %s: %w", ms.TargetFn, oldFn, err)
+	}
+	return nil
+}
+
+// Links the unnamed sponge into the temp directory so it can be renamed.
+func (ms *AtomicSponge) nameSponge() error {
+	fn, err := linkTmpFile(ms.Sponge, ms.TempDir, ms.TempName)
+	if err != nil {
+		return err
+	}
+	err = ms.Sponge.Close()
+	ms.Sponge = nil
+	ms.SpongeFn = fn
+	ms.Unnamed = false
+	return err
+}
+
+func (ms *AtomicSponge) ScratchFn() string {
+	return ms.SpongeFn
+}
+
+func (ms *AtomicSponge) Changed() bool {
+	return !ms.Unchanged
+}
+
+func (ms *AtomicSponge) Cleanup() error {
+	// Writes still in flight must finish before the sponge goes away.
+	if ms.writer != nil {
+		ms.writer.Flush()
+		ms.writer = nil
+	}
+	if ms.Unnamed {
+		if ms.Sponge == nil {
+			return nil
+		}
+		err := ms.Sponge.Close()
+		ms.Sponge = nil
+		return err
+	}
+	if ms.LeaveDirty {
+		return nil
+	}
+	if _, err := os.Stat(ms.SpongeFn); os.IsNotExist(err) {
+		return nil
+	}
+	if err := removeFile(ms.SpongeFn); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Replay reads the new data back from the committed target.
+func (ms *AtomicSponge) Replay(w io.Writer) error {
+	f, err := os.Open(ms.TargetFn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(ms.DataOffset, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
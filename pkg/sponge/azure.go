@@ -0,0 +1,113 @@
+package sponge
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+)
+
+// AzureBlockSize is the smallest block staged by an AzureUploader.
+// Larger blobs use larger blocks to stay within Azure's block limit.
+var AzureBlockSize int64 = 8 << 20
+
+// AzureMaxBlocks is the most blocks a block blob may have.
+const AzureMaxBlocks = 50000
+
+// AzureUploader uploads to an Azure block blob.  It stages the data as
+// uncommitted blocks, which leave the blob untouched, and then commits
+// them all with one call.  Credentials come from
+// AZURE_STORAGE_CONNECTION_STRING if it is set, and otherwise from the
+// default Azure credential chain.
+type AzureUploader struct {
+	Account   string
+	Container string
+	Blob      string
+}
+
+// NewAzureUploader returns an uploader for a URL like
+// azblob://account/container/blob.
+func NewAzureUploader(u *url.URL) (*AzureUploader, error) {
+	parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+	if u.Host == "" || len(parts) < 2 || parts[0] == "" || parts[1] == "" || strings.HasSuffix(parts[1], "/") {
+		return nil, fmt.Errorf("Invalid Azure destination %q, expected azblob://ACCOUNT/CONTAINER/BLOB.", u.String())
+	}
+	return &AzureUploader{Account: u.Host, Container: parts[0], Blob: parts[1]}, nil
+}
+
+func (au *AzureUploader) Upload(ctx context.Context, r io.ReadSeeker, size int64) error {
+	client, err := au.client()
+	if err != nil {
+		return err
+	}
+	blockSize := AzureBlockSize
+	if least := (size + AzureMaxBlocks - 1) / AzureMaxBlocks; least > blockSize {
+		blockSize = least
+	}
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		ra = readerAt{r}
+	}
+	ids := []string{}
+	for offset := int64(0); offset < size; offset += blockSize {
+		n := size - offset
+		if n > blockSize {
+			n = blockSize
+		}
+		// Blocks are retried from their start, so each needs its own seeker.
+		block := io.NewSectionReader(ra, offset, n)
+		id := blockID(len(ids))
+		if _, err := client.StageBlock(ctx, id, streaming.NopCloser(block), nil); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	_, err = client.CommitBlockList(ctx, ids, nil)
+	return err
+}
+
+// Returns a client for the blob, authenticated as configured.
+func (au *AzureUploader) client() (*blockblob.Client, error) {
+	if cs := os.Getenv("AZURE_STORAGE_CONNECTION_STRING"); cs != "" {
+		service, err := azblob.NewClientFromConnectionString(cs, nil)
+		if err != nil {
+			return nil, err
+		}
+		return service.ServiceClient().NewContainerClient(au.Container).NewBlockBlobClient(au.Blob), nil
+	}
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s", au.Account, au.Container, au.Blob)
+	return blockblob.NewClient(u, cred, nil)
+}
+
+// Block IDs must all have the same length.
+func blockID(n int) string {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(n))
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// readerAt reads at offsets by seeking first, for readers which are only
+// used from one goroutine.
+type readerAt struct {
+	r io.ReadSeeker
+}
+
+func (ra readerAt) ReadAt(p []byte, off int64) (int, error) {
+	if _, err := ra.r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.ReadFull(ra.r, p)
+}
@@ -0,0 +1,254 @@
+package sponge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Backups perform backups of the original file.
+
+type Backup interface {
+	// Begin starts backing up the original.  The backup stops if ctx
+	// is done.
+	Begin(ctx context.Context) error
+	// Abort waits for the backup to stop.
+	Abort() error
+	// Complete waits for the backup to finish, giving up when the ctx
+	// given to Begin is done.
+	Complete() error
+}
+
+// NoBackup is a Backup which does nothing.
+type NoBackup struct{}
+
+func (c *NoBackup) Begin(ctx context.Context) error {
+	return nil
+}
+
+func (c *NoBackup) Abort() error {
+	return nil
+}
+
+func (c *NoBackup) Complete() error {
+	return nil
+}
+
+// ConcurrentBackup copies the source to the backup in the background
+// while data is being accumulated.
+type ConcurrentBackup struct {
+	SourceFn string
+	BackupFn string
+	// Numbered backups go to the next unused BackupFn.~N~ instead of
+	// BackupFn.
+	Numbered bool
+	// MakeDirs creates the backup's directory if necessary.
+	MakeDirs bool
+	// NoLink never makes the backup a hard link to the source, for
+	// sources which are modified rather than replaced.
+	NoLink bool
+	Done   chan error
+	// ctx is Begin's, which also bounds the wait in Complete.
+	ctx context.Context
+}
+
+// BackupOptions control where backups go.
+type BackupOptions struct {
+	// Numbered backups never overwrite earlier ones.  See
+	// NextNumberedBackup.
+	Numbered bool
+	// Dir holds backups in a tree mirroring the absolute paths of their
+	// targets.  The template then names the backup within the mirrored
+	// directory, and cannot use {dir} or {file}.
+	Dir string
+	// InPlace targets are overwritten rather than replaced, so their
+	// backups cannot be hard links to them.
+	InPlace bool
+}
+
+// NewConcurrentBackup returns a Backup of source.  The backup filename
+// is expanded from the template backup using BackupFile.
+func NewConcurrentBackup(source, backup string) (Backup, error) {
+	return NewBackup(source, backup, BackupOptions{})
+}
+
+// NewNumberedBackup returns a Backup of source which never overwrites
+// earlier backups.  See NextNumberedBackup.
+func NewNumberedBackup(source, backup string) (Backup, error) {
+	return NewBackup(source, backup, BackupOptions{Numbered: true})
+}
+
+// NewBackup returns a Backup of source placed according to the template
+// backup and opts.
+func NewBackup(source, backup string, opts BackupOptions) (Backup, error) {
+	template, err := BackupTemplate(backup, source, opts)
+	if err != nil {
+		return nil, err
+	}
+	backupFn, err := BackupFile(template, source)
+	if err != nil {
+		return nil, err
+	}
+	return &ConcurrentBackup{
+		SourceFn: source,
+		BackupFn: backupFn,
+		Numbered: opts.Numbered,
+		MakeDirs: opts.Dir != "",
+		NoLink:   opts.InPlace,
+	}, nil
+}
+
+// BackupTemplate returns the template which places backups of source as
+// opts require.
+func BackupTemplate(template, source string, opts BackupOptions) (string, error) {
+	if opts.Dir == "" {
+		return template, nil
+	}
+	for _, ph := range placeholderRe.FindAllString(template, -1) {
+		if ph == "{dir}" || ph == "{file}" {
+			return "", fmt.Errorf("Backup directories cannot use %s in %q.", ph, template)
+		}
+	}
+	abs, err := filepath.Abs(source)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Dir(abs)
+	if vol := filepath.VolumeName(dir); vol != "" {
+		dir = filepath.Join(strings.TrimSuffix(vol, ":"), dir[len(vol):])
+	}
+	if placeholderRe.MatchString(dir) {
+		return "", fmt.Errorf("Cannot mirror %s because its name looks like a placeholder.", dir)
+	}
+	return filepath.Join(opts.Dir, dir, template), nil
+}
+
+func (cb *ConcurrentBackup) Begin(ctx context.Context) error {
+	if cb.MakeDirs {
+		if err := os.MkdirAll(filepath.Dir(cb.BackupFn), 0755); err != nil {
+			return err
+		}
+	}
+	if cb.Numbered {
+		backupFn, err := NextNumberedBackup(cb.BackupFn)
+		if err != nil {
+			return err
+		}
+		cb.BackupFn = backupFn
+		cb.Numbered = false
+	}
+	done, err := copyBackup(ctx, cb.SourceFn, cb.BackupFn, !cb.NoLink)
+	if err != nil {
+		return err
+	}
+	cb.Done = done
+	cb.ctx = ctx
+	return nil
+}
+
+func (cb *ConcurrentBackup) Abort() error {
+	if cb.Done == nil {
+		return nil
+	}
+	return <-cb.Done
+}
+
+func (cb *ConcurrentBackup) Complete() error {
+	if cb.Done == nil {
+		return nil
+	}
+	var err error
+	select {
+	case err = <-cb.Done:
+	case <-cb.ctx.Done():
+		return cb.ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(cb.SourceFn)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(cb.BackupFn, fi.Mode())
+}
+
+// Copy copies src to dest.  It tries a copy-on-write clone first, then a
+// hard link, and otherwise copies in the background, returning a channel
+// which yields the result.
+// The channel is nil when no copy is necessary.  A copy interrupted by
+// ctx removes the partial destination.
+func Copy(ctx context.Context, src, dest string) (chan error, error) {
+	return copyBackup(ctx, src, dest, true)
+}
+
+// Copies src to dest like Copy, only trying a hard link if link is set.
+func copyBackup(ctx context.Context, src, dest string, link bool) (chan error, error) {
+	if src == dest {
+		return nil, errors.New("Will not copy to same filename.")
+	}
+	sfi, err := os.Stat(src)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		} else {
+			return nil, err
+		}
+	}
+	if !sfi.Mode().IsRegular() {
+		return nil, fmt.Errorf("Cannot copy non-regular source file %s (%q)", src, sfi.Mode().String())
+	}
+	dfi, err := os.Stat(dest)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil && !dfi.Mode().IsRegular() {
+		return nil, fmt.Errorf("Cannot copy to non-regular destination %s (%q)", dest, dfi.Mode().String())
+	}
+	if os.SameFile(sfi, dfi) {
+		return nil, nil
+	}
+	if err = cloneFile(src, dest, sfi.Mode()); err == nil {
+		return nil, nil
+	}
+	if link {
+		if err = os.Link(src, dest); err == nil {
+			return nil, nil
+		}
+	}
+	source, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+
+	backup, err := os.Create(dest)
+	if err != nil {
+		source.Close()
+		return nil, err
+	}
+	// Buffered, so the copy can finish after Complete stops waiting.
+	done := make(chan error, 1)
+	go DoConcurrentCopy(ctx, source, backup, done)
+	return done, nil
+}
+
+// CopyChunk is how much DoConcurrentCopy copies between checks for
+// cancellation.
+var CopyChunk int64 = 8 << 20
+
+// DoConcurrentCopy copies source to dest, reporting the outcome on done.
+func DoConcurrentCopy(ctx context.Context, source, dest *os.File, done chan error) {
+	defer source.Close()
+	_, err := copyFile(ctx, source, dest)
+	dest.Close()
+	if err != nil {
+		if ctx.Err() != nil {
+			os.Remove(dest.Name())
+		}
+		done <- err
+	}
+	close(done)
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package sponge
+
+import (
+	"os"
+	"syscall"
+)
+
+// blockSize returns fi's preferred I/O size, st_blksize.
+func blockSize(fi os.FileInfo) int {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+	return int(st.Blksize)
+}
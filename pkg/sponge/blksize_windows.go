@@ -0,0 +1,11 @@
+package sponge
+
+import (
+	"os"
+)
+
+// blockSize is unknown, since Windows does not report a preferred I/O
+// size.
+func blockSize(fi os.FileInfo) int {
+	return 0
+}
@@ -0,0 +1,149 @@
+package sponge
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// CASSponge stores data in a content-addressable directory, named after
+// its SHA-256 digest like DIR/ab/cdef....  Data which is already stored is
+// not written again.
+type CASSponge struct {
+	Dir        string
+	TempName   string
+	Fsync      bool
+	LeaveDirty bool
+	Mode       ModeFunc
+	Verify     func(ctx context.Context, fn string) error
+	SpongeFn   string
+	Sponge     *os.File
+	// ObjectFn names the stored object once Complete has succeeded, and
+	// Existed records that it was already there.
+	ObjectFn string
+	Existed  bool
+	hash     hash.Hash
+}
+
+// NewCASSponge returns a sponge which stores its data under dir.
+func NewCASSponge(dir string, opts Options) *CASSponge {
+	return &CASSponge{
+		Dir:        dir,
+		TempName:   opts.TempName,
+		Fsync:      opts.Fsync,
+		LeaveDirty: opts.LeaveDirty,
+		Mode:       opts.Mode,
+		Verify:     opts.Verify,
+	}
+}
+
+// CASPath returns where data with the hex digest is stored under dir.
+func CASPath(dir, digest string) string {
+	return filepath.Join(dir, digest[:2], digest[2:])
+}
+
+func (cs *CASSponge) Begin(ctx context.Context) error {
+	sponge, err := createTemp(cs.Dir, cs.TempName)
+	if err != nil {
+		return err
+	}
+	cs.Sponge = sponge
+	cs.SpongeFn = sponge.Name()
+	cs.hash = sha256.New()
+	return nil
+}
+
+func (cs *CASSponge) Abort() error {
+	return nil
+}
+
+func (cs *CASSponge) Write(d []byte) error {
+	cs.hash.Write(d)
+	n, err := cs.Sponge.Write(d)
+	if err != nil {
+		return err
+	}
+	if n < len(d) {
+		return io.ErrShortWrite
+	}
+	return nil
+}
+
+func (cs *CASSponge) Complete(ctx context.Context) error {
+	if cs.Fsync {
+		if err := cs.Sponge.Sync(); err != nil {
+			return err
+		}
+	}
+	err := cs.Sponge.Close()
+	cs.Sponge = nil
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if cs.Verify != nil {
+		if err := cs.Verify(ctx, cs.SpongeFn); err != nil {
+			return err
+		}
+	}
+	objectFn := CASPath(cs.Dir, hex.EncodeToString(cs.hash.Sum(nil)))
+	if _, err := os.Stat(objectFn); err == nil {
+		cs.ObjectFn = objectFn
+		cs.Existed = true
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(objectFn), 0777); err != nil {
+		return err
+	}
+	if err := os.Chmod(cs.SpongeFn, newMode(DEFAULT_MODE, cs.Mode)); err != nil {
+		return err
+	}
+	// Racing writers of the same data replace it with identical data.
+	if err := replaceFile(ctx, cs.SpongeFn, objectFn); err != nil {
+		return err
+	}
+	cs.ObjectFn = objectFn
+	if cs.Fsync {
+		return SyncDir(filepath.Dir(objectFn))
+	}
+	return nil
+}
+
+func (cs *CASSponge) ScratchFn() string {
+	return cs.SpongeFn
+}
+
+func (cs *CASSponge) Changed() bool {
+	return !cs.Existed
+}
+
+func (cs *CASSponge) Cleanup() error {
+	if cs.Sponge != nil {
+		cs.Sponge.Close()
+		cs.Sponge = nil
+	}
+	if cs.LeaveDirty {
+		return nil
+	}
+	if _, err := os.Stat(cs.SpongeFn); os.IsNotExist(err) {
+		return nil
+	}
+	return removeFile(cs.SpongeFn)
+}
+
+// Replay reads the data back from the stored object.
+func (cs *CASSponge) Replay(w io.Writer) error {
+	f, err := os.Open(cs.ObjectFn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
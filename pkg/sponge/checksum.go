@@ -0,0 +1,182 @@
+package sponge
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Checksums maps the supported checksum algorithms to their hashes.  The
+// algorithm name is also the extension of the sidecar file.
+var Checksums = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+	"blake2b": func() hash.Hash {
+		h, _ := blake2b.New512(nil)
+		return h
+	},
+}
+
+// NewChecksum returns a new hash for the named algorithm.
+func NewChecksum(algorithm string) (hash.Hash, error) {
+	newHash, ok := Checksums[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("Unknown checksum algorithm %q.", algorithm)
+	}
+	return newHash(), nil
+}
+
+// VerifiedReader passes r through, but fails at its end unless the data
+// had the hex digest expected by algorithm.
+func VerifiedReader(r io.Reader, algorithm, expected string) (io.Reader, error) {
+	h, err := NewChecksum(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return &verifiedReader{r, h, algorithm, strings.ToLower(expected)}, nil
+}
+
+type verifiedReader struct {
+	r         io.Reader
+	hash      hash.Hash
+	algorithm string
+	expected  string
+}
+
+func (vr *verifiedReader) Read(p []byte) (int, error) {
+	n, err := vr.r.Read(p)
+	vr.hash.Write(p[:n])
+	if err == io.EOF {
+		if digest := hex.EncodeToString(vr.hash.Sum(nil)); digest != vr.expected {
+			return n, fmt.Errorf("Input has %s %s, not %s.", vr.algorithm, digest, vr.expected)
+		}
+	}
+	return n, err
+}
+
+// ChecksumSponge digests the data as it passes through to Sponge, and
+// after the target is committed it atomically writes a sidecar file
+// named after the target plus the algorithm, e.g. "data.txt.sha256".
+// The sidecar uses the format of sha256sum(1) and friends.
+type ChecksumSponge struct {
+	Sponge    SpongeFile
+	TargetFn  string
+	Algorithm string
+	Hash      hash.Hash
+	Append    bool
+	// Options for writing the sidecar.
+	Options Options
+	sidecar SpongeFile
+}
+
+// NewChecksumSponge wraps sf, which writes targetFn, with a checksum
+// sidecar.
+func NewChecksumSponge(sf SpongeFile, targetFn, algorithm string, opts Options) (SpongeFile, error) {
+	h, err := NewChecksum(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	cs := &ChecksumSponge{
+		Sponge:    sf,
+		TargetFn:  targetFn,
+		Algorithm: algorithm,
+		Hash:      h,
+		Append:    opts.Append,
+		Options:   opts,
+	}
+	cs.Options.Append = false
+	cs.Options.Verify = nil
+	return cs, nil
+}
+
+// SidecarFn is the name of the checksum file for the target.
+func (cs *ChecksumSponge) SidecarFn() string {
+	return cs.TargetFn + "." + cs.Algorithm
+}
+
+// Digest returns the hex encoded checksum of the target.
+func (cs *ChecksumSponge) Digest() string {
+	return hex.EncodeToString(cs.Hash.Sum(nil))
+}
+
+func (cs *ChecksumSponge) Begin(ctx context.Context) error {
+	if cs.Append {
+		if err := cs.hashTarget(); err != nil {
+			return err
+		}
+	}
+	return cs.Sponge.Begin(ctx)
+}
+
+// When appending the digest covers the existing contents too.
+func (cs *ChecksumSponge) hashTarget() error {
+	f, err := os.Open(cs.TargetFn)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(cs.Hash, f)
+	return err
+}
+
+func (cs *ChecksumSponge) Write(d []byte) error {
+	cs.Hash.Write(d)
+	return cs.Sponge.Write(d)
+}
+
+func (cs *ChecksumSponge) Abort() error {
+	return cs.Sponge.Abort()
+}
+
+func (cs *ChecksumSponge) Complete(ctx context.Context) error {
+	if err := cs.Sponge.Complete(ctx); err != nil {
+		return err
+	}
+	cs.sidecar = NewAtomicSponge(cs.SidecarFn(), cs.Options)
+	if err := cs.sidecar.Begin(ctx); err != nil {
+		return err
+	}
+	line := fmt.Sprintf("%s  %s\n", cs.Digest(), path.Base(cs.TargetFn))
+	if err := cs.sidecar.Write([]byte(line)); err != nil {
+		return err
+	}
+	return cs.sidecar.Complete(ctx)
+}
+
+func (cs *ChecksumSponge) Cleanup() error {
+	err := cs.Sponge.Cleanup()
+	if cs.sidecar != nil {
+		if err1 := cs.sidecar.Cleanup(); err == nil {
+			err = err1
+		}
+	}
+	return err
+}
+
+func (cs *ChecksumSponge) Replay(w io.Writer) error {
+	return replay(cs.Sponge, w)
+}
+
+func (cs *ChecksumSponge) Changed() bool {
+	return changed(cs.Sponge)
+}
+
+func (cs *ChecksumSponge) ScratchFn() string {
+	return ScratchFn(cs.Sponge)
+}
@@ -0,0 +1,19 @@
+package sponge
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile makes dest a copy-on-write clone of src with clonefile(2),
+// which APFS supports.  Clones keep src's mode.
+func cloneFile(src, dest string, mode os.FileMode) error {
+	if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := unix.Clonefile(src, dest, unix.CLONE_NOFOLLOW); err != nil {
+		return &os.LinkError{Op: "clonefile", Old: src, New: dest, Err: err}
+	}
+	return nil
+}
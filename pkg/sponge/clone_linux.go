@@ -0,0 +1,32 @@
+package sponge
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile makes dest a copy-on-write clone of src with FICLONE, which
+// btrfs and XFS support.  dest gets src's mode.
+func cloneFile(src, dest string, mode os.FileMode) error {
+	source, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	clone, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	err = unix.IoctlFileClone(int(clone.Fd()), int(source.Fd()))
+	if err == nil {
+		err = clone.Chmod(mode)
+	}
+	if err1 := clone.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		os.Remove(dest)
+	}
+	return err
+}
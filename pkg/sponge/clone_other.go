@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package sponge
+
+import (
+	"errors"
+	"os"
+)
+
+// cloneFile fails, because there is no way to clone files here.
+func cloneFile(src, dest string, mode os.FileMode) error {
+	return errors.New("Cannot clone files on this platform.")
+}
@@ -0,0 +1,90 @@
+package sponge
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// Changer is implemented by sponges which may leave an unchanged target
+// alone.  Changed reports whether Complete modified a target.
+type Changer interface {
+	Changed() bool
+}
+
+// Reports whether sf changed its target, assuming it did when sf can't
+// tell.
+func changed(sf SpongeFile) bool {
+	if c, ok := sf.(Changer); ok {
+		return c.Changed()
+	}
+	return true
+}
+
+// FileHasContents reports whether fn exists and contains exactly data.
+func FileHasContents(fn string, data []byte) (bool, error) {
+	f, err := os.Open(fn)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	return SameContents(f, bytes.NewReader(data))
+}
+
+// SameFileContents reports whether the files a and b both exist and
+// have identical contents.
+func SameFileContents(a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+	ia, err := fa.Stat()
+	if err != nil {
+		return false, err
+	}
+	ib, err := fb.Stat()
+	if err != nil {
+		return false, err
+	}
+	if ia.Size() != ib.Size() {
+		return false, nil
+	}
+	return SameContents(fa, fb)
+}
+
+// SameContents reports whether a and b yield identical data.
+func SameContents(a, b io.Reader) (bool, error) {
+	bufA := make([]byte, READSIZE)
+	bufB := make([]byte, READSIZE)
+	for {
+		na, errA := io.ReadFull(a, bufA)
+		nb, errB := io.ReadFull(b, bufB)
+		if errA != nil && errA != io.EOF && errA != io.ErrUnexpectedEOF {
+			return false, errA
+		}
+		if errB != nil && errB != io.EOF && errB != io.ErrUnexpectedEOF {
+			return false, errB
+		}
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+		if errA != nil || errB != nil {
+			return errA != nil && errB != nil, nil
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package sponge
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+)
+
+// DefaultLevel selects a codec's default compression level.
+const DefaultLevel = -1
+
+// Codec compresses data on its way into a sponge.
+type Codec interface {
+	// NewWriter returns a writer which compresses into w at level,
+	// which is DefaultLevel or a codec specific level.  Closing it
+	// flushes everything to w without closing w.
+	NewWriter(w io.Writer, level int) (io.WriteCloser, error)
+	// NewReader returns a reader which decompresses r.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// Codecs maps the names of the supported compression formats to their
+// codecs.
+var Codecs = map[string]Codec{
+	"gzip":  GzipCodec{},
+	"zstd":  ZstdCodec{},
+	"xz":    XzCodec{},
+	"lz4":   Lz4Codec{},
+	"bzip2": Bzip2Codec{},
+}
+
+// GetCodec returns the named codec.
+func GetCodec(name string) (Codec, error) {
+	codec, ok := Codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown compression format %q.", name)
+	}
+	return codec, nil
+}
+
+func checkLevel(format string, level, min, max int) error {
+	if level != DefaultLevel && (level < min || level > max) {
+		return fmt.Errorf("%s compression level must be between %d and %d.", format, min, max)
+	}
+	return nil
+}
+
+// GzipCodec produces gzip data at levels 1 through 9.
+type GzipCodec struct{}
+
+func (GzipCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	if err := checkLevel("gzip", level, gzip.BestSpeed, gzip.BestCompression); err != nil {
+		return nil, err
+	}
+	return gzip.NewWriterLevel(w, level)
+}
+
+func (GzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// ZstdCodec produces zstd data at levels 1 through 22.
+type ZstdCodec struct{}
+
+func (ZstdCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	if err := checkLevel("zstd", level, 1, 22); err != nil {
+		return nil, err
+	}
+	if level == DefaultLevel {
+		return zstd.NewWriter(w)
+	}
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+}
+
+func (ZstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	dec, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return dec.IOReadCloser(), nil
+}
+
+// XzCodec produces xz data.  Levels 0 through 9 choose dictionaries of
+// 256KiB through 64MiB, like xz(1) presets.
+type XzCodec struct{}
+
+var xzDictCaps = []int{
+	256 << 10, 1 << 20, 2 << 20, 4 << 20, 4 << 20,
+	8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20,
+}
+
+func (XzCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	if err := checkLevel("xz", level, 0, 9); err != nil {
+		return nil, err
+	}
+	if level == DefaultLevel {
+		level = 6
+	}
+	return xz.WriterConfig{DictCap: xzDictCaps[level]}.NewWriter(w)
+}
+
+func (XzCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	dec, err := xz.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(dec), nil
+}
+
+// Lz4Codec produces lz4 frames at levels 1 through 9.
+type Lz4Codec struct{}
+
+var lz4Levels = []lz4.CompressionLevel{
+	lz4.Level1, lz4.Level2, lz4.Level3, lz4.Level4, lz4.Level5,
+	lz4.Level6, lz4.Level7, lz4.Level8, lz4.Level9,
+}
+
+func (Lz4Codec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	if err := checkLevel("lz4", level, 1, 9); err != nil {
+		return nil, err
+	}
+	enc := lz4.NewWriter(w)
+	if level != DefaultLevel {
+		if err := enc.Apply(lz4.CompressionLevelOption(lz4Levels[level-1])); err != nil {
+			return nil, err
+		}
+	}
+	return enc, nil
+}
+
+func (Lz4Codec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(lz4.NewReader(r)), nil
+}
+
+// Bzip2Codec produces bzip2 data at levels 1 through 9.
+type Bzip2Codec struct{}
+
+func (Bzip2Codec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	if err := checkLevel("bzip2", level, bzip2.BestSpeed, bzip2.BestCompression); err != nil {
+		return nil, err
+	}
+	if level == DefaultLevel {
+		level = bzip2.DefaultCompression
+	}
+	return bzip2.NewWriter(w, &bzip2.WriterConfig{Level: level})
+}
+
+func (Bzip2Codec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return bzip2.NewReader(r, nil)
+}
+
+// CompressSponge compresses data before passing it on to Sponge.
+type CompressSponge struct {
+	EncodingSponge
+	Codec Codec
+	Level int
+}
+
+// NewCompressSponge wraps sf so the data it receives is compressed with
+// codec at level.
+func NewCompressSponge(sf SpongeFile, codec Codec, level int) SpongeFile {
+	cs := &CompressSponge{
+		Codec: codec,
+		Level: level,
+	}
+	cs.Sponge = sf
+	cs.NewEncoder = func(w io.Writer) (io.WriteCloser, error) {
+		return codec.NewWriter(w, level)
+	}
+	return cs
+}
+
+// Replay writes the uncompressed data.
+func (cs *CompressSponge) Replay(w io.Writer) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(replay(cs.Sponge, pw))
+	}()
+	defer pr.Close()
+	dec, err := cs.Codec.NewReader(pr)
+	if err != nil {
+		return err
+	}
+	defer dec.Close()
+	_, err = io.Copy(w, dec)
+	return err
+}
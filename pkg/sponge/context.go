@@ -0,0 +1,112 @@
+package sponge
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// ContextReader returns a reader which fails with ctx.Err() once ctx is
+// done.
+func ContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, r: r}
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := cr.r.Read(p)
+	if err != nil && cr.ctx.Err() != nil {
+		return n, cr.ctx.Err()
+	}
+	return n, err
+}
+
+type deadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// InterruptibleReader returns a reader whose blocked reads fail with
+// ctx.Err() when ctx is done.  Readers supporting deadlines are woken
+// by setting one.  Other reads are handed to a single goroutine which is
+// abandoned on cancellation, so the caller must discard its buffer
+// afterwards.  Call the returned function once reading is over to
+// release the context and the goroutine.
+func InterruptibleReader(ctx context.Context, r io.Reader) (io.Reader, func() bool) {
+	if ctx.Done() == nil {
+		return r, func() bool { return false }
+	}
+	if d, ok := r.(deadliner); ok && d.SetReadDeadline(time.Time{}) == nil {
+		stop := context.AfterFunc(ctx, func() {
+			d.SetReadDeadline(time.Now())
+		})
+		return ContextReader(ctx, r), stop
+	}
+	ar := &asyncReader{
+		ctx:      ctx,
+		r:        r,
+		requests: make(chan []byte),
+		results:  make(chan readResult, 1),
+		done:     make(chan struct{}),
+	}
+	go ar.serve()
+	return ar, ar.stop
+}
+
+type readResult struct {
+	n   int
+	err error
+}
+
+type asyncReader struct {
+	ctx      context.Context
+	r        io.Reader
+	requests chan []byte
+	results  chan readResult
+	done     chan struct{}
+	once     sync.Once
+}
+
+func (ar *asyncReader) Read(p []byte) (int, error) {
+	if err := ar.ctx.Err(); err != nil {
+		return 0, err
+	}
+	select {
+	case ar.requests <- p:
+	case <-ar.ctx.Done():
+		return 0, ar.ctx.Err()
+	case <-ar.done:
+		return 0, io.ErrClosedPipe
+	}
+	select {
+	case res := <-ar.results:
+		return res.n, res.err
+	case <-ar.ctx.Done():
+		return 0, ar.ctx.Err()
+	}
+}
+
+// serve performs reads on behalf of Read until stop is called.
+func (ar *asyncReader) serve() {
+	for {
+		select {
+		case p := <-ar.requests:
+			n, err := ar.r.Read(p)
+			ar.results <- readResult{n, err}
+		case <-ar.done:
+			return
+		}
+	}
+}
+
+func (ar *asyncReader) stop() bool {
+	ar.once.Do(func() { close(ar.done) })
+	return false
+}
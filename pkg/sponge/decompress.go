@@ -0,0 +1,59 @@
+package sponge
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Magic maps compression formats to the bytes which begin their data.
+var Magic = map[string][]byte{
+	"gzip":  {0x1f, 0x8b},
+	"zstd":  {0x28, 0xb5, 0x2f, 0xfd},
+	"xz":    {0xfd, '7', 'z', 'X', 'Z', 0x00},
+	"lz4":   {0x04, 0x22, 0x4d, 0x18},
+	"bzip2": {'B', 'Z', 'h'},
+}
+
+// DetectFormat peeks at the start of r and returns the name of its
+// compression format, or "" if it is not compressed.
+func DetectFormat(r *bufio.Reader) (string, error) {
+	head, err := r.Peek(8)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	for format, magic := range Magic {
+		if bytes.HasPrefix(head, magic) {
+			return format, nil
+		}
+	}
+	return "", nil
+}
+
+// NewDecompressReader returns a reader which decompresses r using the
+// named format.  The format "auto" detects the format from the data, and
+// passes uncompressed data through unchanged.
+func NewDecompressReader(r io.Reader, format string) (io.ReadCloser, error) {
+	if format == "auto" {
+		br := bufio.NewReader(r)
+		detected, err := DetectFormat(br)
+		if err != nil {
+			return nil, err
+		}
+		if detected == "" {
+			return ioutil.NopCloser(br), nil
+		}
+		r, format = br, detected
+	}
+	codec, err := GetCodec(format)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := codec.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot decompress %s input: %s", format, err)
+	}
+	return dec, nil
+}
@@ -0,0 +1,91 @@
+package sponge
+
+import (
+	"io"
+	"os"
+	"unsafe"
+)
+
+// DirectBufferSize is how much data direct sponges gather before writing
+// it out.  It is a multiple of DirectAlign.
+var DirectBufferSize = 1 << 20
+
+// DirectAlign is the alignment of direct writes' buffers, offsets, and
+// lengths.
+var DirectAlign = 4096
+
+// directWriter writes to a file opened for direct I/O, which bypasses the
+// page cache.  Data is gathered into an aligned buffer and written out a
+// whole buffer at a time, and only the final partial block is written
+// through the cache.
+type directWriter struct {
+	f   *os.File
+	buf []byte
+	n   int
+}
+
+// newDirectWriter turns on direct I/O for f, whose data ends at offset.
+// It fails if the platform or filesystem does not support direct I/O.
+func newDirectWriter(f *os.File, offset int64) (*directWriter, error) {
+	dw := &directWriter{f: f, buf: alignedBuffer(DirectBufferSize)}
+	// Writes must start on a block boundary, so an unaligned offset means
+	// rewriting the start of the last block.
+	start := offset &^ int64(DirectAlign-1)
+	dw.n = int(offset - start)
+	if dw.n > 0 {
+		if _, err := f.ReadAt(dw.buf[:dw.n], start); err != nil {
+			return nil, err
+		}
+		if _, err := f.Seek(start, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	if err := setDirect(f, true); err != nil {
+		return nil, err
+	}
+	return dw, nil
+}
+
+func (dw *directWriter) Write(d []byte) (int, error) {
+	written := 0
+	for len(d) > 0 {
+		n := copy(dw.buf[dw.n:], d)
+		dw.n += n
+		written += n
+		d = d[n:]
+		if dw.n == len(dw.buf) {
+			if err := writeAll(dw.f, dw.buf); err != nil {
+				return written, err
+			}
+			dw.n = 0
+		}
+	}
+	return written, nil
+}
+
+// Flush writes out the buffered data and turns direct I/O off again.
+func (dw *directWriter) Flush() error {
+	whole := dw.n &^ (DirectAlign - 1)
+	if whole > 0 {
+		if err := writeAll(dw.f, dw.buf[:whole]); err != nil {
+			return err
+		}
+	}
+	if err := setDirect(dw.f, false); err != nil {
+		return err
+	}
+	err := writeAll(dw.f, dw.buf[whole:dw.n])
+	dw.n = 0
+	return err
+}
+
+// alignedBuffer returns a buffer of size bytes starting on a DirectAlign
+// boundary.
+func alignedBuffer(size int) []byte {
+	buf := make([]byte, size+DirectAlign)
+	skip := 0
+	if r := int(uintptr(unsafe.Pointer(&buf[0])) & uintptr(DirectAlign-1)); r != 0 {
+		skip = DirectAlign - r
+	}
+	return buf[skip : skip+size]
+}
@@ -0,0 +1,20 @@
+package sponge
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// setDirect turns F_NOCACHE on or off for f, which is macOS's closest
+// equivalent to O_DIRECT.
+func setDirect(f *os.File, on bool) error {
+	arg := 0
+	if on {
+		arg = 1
+	}
+	if _, err := unix.FcntlInt(f.Fd(), unix.F_NOCACHE, arg); err != nil {
+		return os.NewSyscallError("fcntl", err)
+	}
+	return nil
+}
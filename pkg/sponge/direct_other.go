@@ -0,0 +1,17 @@
+//go:build !linux && !darwin
+
+package sponge
+
+import (
+	"errors"
+	"os"
+)
+
+// setDirect fails, because there is no way to bypass the page cache for
+// an open file here.
+func setDirect(f *os.File, on bool) error {
+	if !on {
+		return nil
+	}
+	return errors.New("Cannot use direct I/O on this platform.")
+}
@@ -0,0 +1,45 @@
+// Package sponge accumulates data and writes it to its destination only
+// once the data is complete.
+//
+// A SpongeFile is driven through Begin, any number of Writes, and then
+// either Complete or Abort.  Cleanup must always be called afterwards to
+// remove scratch files.  A Backup preserves the original destination and
+// is driven alongside the sponge:
+//
+//	bf, err := sponge.NewConcurrentBackup(target, "{file}.old")
+//	if err != nil {
+//		return err
+//	}
+//	sf := sponge.NewAtomicSponge(target, sponge.Options{})
+//	if err := bf.Begin(ctx); err != nil {
+//		return err
+//	}
+//	if err := sf.Begin(ctx); err != nil {
+//		bf.Abort()
+//		return err
+//	}
+//	defer sf.Cleanup()
+//	if err := sponge.Transfer(ctx, in, sf); err != nil {
+//		bf.Abort()
+//		sf.Abort()
+//		return err
+//	}
+//	if err := bf.Complete(); err != nil {
+//		sf.Abort()
+//		return err
+//	}
+//	return sf.Complete(ctx)
+//
+// Writer wraps a SpongeFile as an io.WriteCloser for use with io.Copy
+// and friends:
+//
+//	w, err := sponge.Create(ctx, target, sponge.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	if _, err := io.Copy(w, in); err != nil {
+//		w.Abort()
+//		return err
+//	}
+//	return w.Close()
+package sponge
@@ -0,0 +1,82 @@
+package sponge
+
+import (
+	"context"
+	"os"
+)
+
+// DryRunSponge accumulates data in memory and works out what committing
+// it would do, without touching the filesystem.
+type DryRunSponge struct {
+	TargetFn string
+	Data     []byte
+	Append   bool
+	NewMode  ModeFunc
+	// Filled in by Complete.
+	Exists  bool
+	Size    int64
+	Mode    os.FileMode
+	Differs bool
+}
+
+// NewDryRunSponge returns a sponge which plans, but never makes, the
+// changes to targetFn.
+func NewDryRunSponge(targetFn string, opts Options) *DryRunSponge {
+	return &DryRunSponge{
+		TargetFn: targetFn,
+		Data:     make([]byte, 0, READSIZE),
+		Append:   opts.Append,
+		NewMode:  opts.Mode,
+	}
+}
+
+func (ds *DryRunSponge) Begin(ctx context.Context) error {
+	return nil
+}
+
+func (ds *DryRunSponge) Abort() error {
+	return nil
+}
+
+func (ds *DryRunSponge) Write(d []byte) error {
+	ds.Data = append(ds.Data, d...)
+	return nil
+}
+
+func (ds *DryRunSponge) Complete(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fi, err := os.Stat(ds.TargetFn)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	ds.Exists = err == nil
+	ds.Size = int64(len(ds.Data))
+	ds.Mode = DEFAULT_MODE
+	if ds.Exists {
+		ds.Mode = fi.Mode()
+	}
+	ds.Mode = newMode(ds.Mode, ds.NewMode)
+	if ds.Append {
+		if ds.Exists {
+			ds.Size += fi.Size()
+		}
+		ds.Differs = len(ds.Data) > 0 || !ds.Exists
+		return nil
+	}
+	same, err := FileHasContents(ds.TargetFn, ds.Data)
+	if err != nil {
+		return err
+	}
+	ds.Differs = !same
+	return nil
+}
+
+func (ds *DryRunSponge) Changed() bool {
+	return ds.Differs
+}
+
+func (ds *DryRunSponge) Cleanup() error {
+	return nil
+}
@@ -0,0 +1,68 @@
+package sponge
+
+import (
+	"context"
+	"io"
+)
+
+// EncodingSponge passes data through an encoder, such as a compressor
+// or an encryptor, on its way to Sponge.
+type EncodingSponge struct {
+	Sponge SpongeFile
+	// NewEncoder returns an encoder writing to w.  Closing the encoder
+	// must flush it without closing w.
+	NewEncoder func(w io.Writer) (io.WriteCloser, error)
+	Encoder    io.WriteCloser
+}
+
+func (es *EncodingSponge) Begin(ctx context.Context) error {
+	if err := es.Sponge.Begin(ctx); err != nil {
+		return err
+	}
+	enc, err := es.NewEncoder(spongeWriter{es.Sponge})
+	if err != nil {
+		return err
+	}
+	es.Encoder = enc
+	return nil
+}
+
+func (es *EncodingSponge) Write(d []byte) error {
+	_, err := es.Encoder.Write(d)
+	return err
+}
+
+func (es *EncodingSponge) Abort() error {
+	return es.Sponge.Abort()
+}
+
+func (es *EncodingSponge) Complete(ctx context.Context) error {
+	if err := es.Encoder.Close(); err != nil {
+		return err
+	}
+	return es.Sponge.Complete(ctx)
+}
+
+func (es *EncodingSponge) Cleanup() error {
+	return es.Sponge.Cleanup()
+}
+
+func (es *EncodingSponge) Changed() bool {
+	return changed(es.Sponge)
+}
+
+func (es *EncodingSponge) ScratchFn() string {
+	return ScratchFn(es.Sponge)
+}
+
+// spongeWriter adapts a begun SpongeFile to io.Writer.
+type spongeWriter struct {
+	sf SpongeFile
+}
+
+func (sw spongeWriter) Write(p []byte) (int, error) {
+	if err := sw.sf.Write(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
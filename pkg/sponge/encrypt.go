@@ -0,0 +1,37 @@
+package sponge
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+)
+
+// ParseAgeRecipient parses an age public key ("age1...") or an SSH
+// public key ("ssh-ed25519 ..." or "ssh-rsa ...").
+func ParseAgeRecipient(s string) (age.Recipient, error) {
+	var r age.Recipient
+	var err error
+	if strings.HasPrefix(s, "ssh-") {
+		r, err = agessh.ParseRecipient(s)
+	} else {
+		r, err = age.ParseX25519Recipient(s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid age recipient %q: %s", s, err)
+	}
+	return r, nil
+}
+
+// NewAgeSponge wraps sf so the data it receives is encrypted to
+// recipients with age.  The encrypted data cannot be replayed.
+func NewAgeSponge(sf SpongeFile, recipients []age.Recipient) SpongeFile {
+	return &EncodingSponge{
+		Sponge: sf,
+		NewEncoder: func(w io.Writer) (io.WriteCloser, error) {
+			return age.Encrypt(w, recipients...)
+		},
+	}
+}
@@ -0,0 +1,22 @@
+package sponge
+
+import (
+	"context"
+	"os"
+)
+
+// exchangeByLink replaces dst with src, first hard linking dst at oldFn
+// so that its old contents are kept there.  Dst never goes missing, but
+// the two steps are not one atomic swap.
+func exchangeByLink(ctx context.Context, src, dst, oldFn string) error {
+	if err := os.Remove(oldFn); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(dst, oldFn); err != nil {
+		if os.IsNotExist(err) {
+			return replaceFile(ctx, src, dst)
+		}
+		return err
+	}
+	return replaceFile(ctx, src, dst)
+}
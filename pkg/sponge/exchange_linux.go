@@ -0,0 +1,27 @@
+package sponge
+
+import (
+	"context"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// exchangeFile atomically swaps src and dst with renameat2(RENAME_EXCHANGE),
+// reporting whether it did, in which case src now holds dst's old
+// contents.  A missing dst is simply replaced, and filesystems without
+// the swap instead link dst at oldFn first.  It retries while dst is busy.
+func exchangeFile(ctx context.Context, src, dst, oldFn string) (bool, error) {
+	err := retryBusy(ctx, func() error {
+		return unix.Renameat2(unix.AT_FDCWD, src, unix.AT_FDCWD, dst, unix.RENAME_EXCHANGE)
+	})
+	switch err {
+	case nil:
+		return true, nil
+	case unix.ENOENT:
+		return false, replaceFile(ctx, src, dst)
+	case unix.EINVAL, unix.ENOSYS:
+		return false, exchangeByLink(ctx, src, dst, oldFn)
+	}
+	return false, &os.LinkError{Op: "exchange", Old: src, New: dst, Err: err}
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package sponge
+
+import (
+	"context"
+)
+
+// exchangeFile replaces dst with src, keeping dst's old contents at oldFn
+// by linking it there first.  It never swaps src and dst.
+func exchangeFile(ctx context.Context, src, dst, oldFn string) (bool, error) {
+	return false, exchangeByLink(ctx, src, dst, oldFn)
+}
@@ -0,0 +1,51 @@
+package sponge
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// FallbackError reports that the target's filesystem was read-only, so
+// the data was saved in FallbackFn instead.
+type FallbackError struct {
+	Fn         string
+	FallbackFn string
+	Err        error
+}
+
+func (e *FallbackError) Error() string {
+	return fmt.Sprintf("Cannot write %s, so the data was saved in %s instead: %s", e.Fn, e.FallbackFn, e.Err)
+}
+
+func (e *FallbackError) Unwrap() error {
+	return e.Err
+}
+
+// saveFallback atomically writes the data from r to opts.FallbackFn, when
+// err shows targetFn's filesystem is read-only, and returns a
+// *FallbackError.  Other errors, or no FallbackFn, are returned as they
+// are.  The fallback is written with the target's opts, less those which
+// only concern the target itself.
+func saveFallback(ctx context.Context, targetFn string, opts Options, r io.Reader, err error) error {
+	fallbackFn := opts.FallbackFn
+	if fallbackFn == "" || !readOnly(err) {
+		return err
+	}
+	opts.FallbackFn = ""
+	opts.Append = false
+	opts.Precondition = nil
+	opts.ExchangeFn = ""
+	sf := NewAtomicSponge(fallbackFn, opts)
+	defer sf.Cleanup()
+	if ferr := sf.Begin(ctx); ferr != nil {
+		return fmt.Errorf("%w, and the data couldn't be saved in %s: %s", err, fallbackFn, ferr)
+	}
+	if ferr := Transfer(ctx, r, sf); ferr != nil {
+		return fmt.Errorf("%w, and the data couldn't be saved in %s: %s", err, fallbackFn, ferr)
+	}
+	if ferr := sf.Complete(ctx); ferr != nil {
+		return fmt.Errorf("%w, and the data couldn't be saved in %s: %s", err, fallbackFn, ferr)
+	}
+	return &FallbackError{Fn: targetFn, FallbackFn: fallbackFn, Err: err}
+}
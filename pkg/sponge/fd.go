@@ -0,0 +1,38 @@
+package sponge
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// FileUploader writes the data over an already open file, such as an
+// inherited descriptor.  A regular file is truncated first and flushed
+// to storage afterwards, so unlike a rename it is not replaced
+// atomically.  Pipes and sockets are simply written to.
+type FileUploader struct {
+	File *os.File
+}
+
+func (fu FileUploader) Upload(ctx context.Context, r io.ReadSeeker, size int64) error {
+	fi, err := fu.File.Stat()
+	if err != nil {
+		return err
+	}
+	regular := fi.Mode().IsRegular()
+	if regular {
+		if err := fu.File.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := fu.File.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	if _, err := io.Copy(fu.File, ContextReader(ctx, r)); err != nil {
+		return err
+	}
+	if regular {
+		return fu.File.Sync()
+	}
+	return nil
+}
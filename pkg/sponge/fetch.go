@@ -0,0 +1,130 @@
+package sponge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// FetchRetryDelay is how long a URLReader waits before resuming.
+var FetchRetryDelay = time.Second
+
+// IsURL reports whether fn is an http or https URL rather than a file.
+func IsURL(fn string) bool {
+	return strings.HasPrefix(fn, "http://") || strings.HasPrefix(fn, "https://")
+}
+
+// URLReader downloads a URL.  When the connection fails part way it asks
+// the server for the rest with a Range request, up to Retries times,
+// provided the server can show that the resource has not changed.
+type URLReader struct {
+	URL     string
+	Client  *http.Client
+	Retries int
+	// Size is the length of the resource, or -1 if unknown.
+	Size      int64
+	ctx       context.Context
+	body      io.ReadCloser
+	validator string
+	n         int64
+}
+
+// OpenURL starts downloading url, failing unless the server answers
+// successfully.
+func OpenURL(ctx context.Context, url string, retries int) (*URLReader, error) {
+	ur := &URLReader{
+		URL:     url,
+		Client:  http.DefaultClient,
+		Retries: retries,
+		Size:    -1,
+		ctx:     ctx,
+	}
+	if err := ur.get(); err != nil {
+		return nil, err
+	}
+	return ur, nil
+}
+
+// Requests the resource from the current offset onwards.
+func (ur *URLReader) get() error {
+	req, err := http.NewRequestWithContext(ur.ctx, http.MethodGet, ur.URL, nil)
+	if err != nil {
+		return err
+	}
+	if ur.n > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", ur.n))
+		req.Header.Set("If-Range", ur.validator)
+	}
+	resp, err := ur.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	switch {
+	case ur.n == 0 && resp.StatusCode == http.StatusOK:
+		ur.Size = resp.ContentLength
+		// Only strong validators may be used with If-Range.
+		ur.validator = resp.Header.Get("ETag")
+		if ur.validator == "" || strings.HasPrefix(ur.validator, "W/") {
+			ur.validator = resp.Header.Get("Last-Modified")
+		}
+	case ur.n > 0 && resp.StatusCode == http.StatusPartialContent:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", ur.n)) {
+			resp.Body.Close()
+			return fmt.Errorf("Cannot resume %s: server sent the wrong range.", ur.URL)
+		}
+	case ur.n > 0 && resp.StatusCode == http.StatusOK:
+		resp.Body.Close()
+		return fmt.Errorf("Cannot resume %s: it changed, or the server does not support ranges.", ur.URL)
+	default:
+		resp.Body.Close()
+		return fmt.Errorf("Cannot fetch %s: %s.", ur.URL, resp.Status)
+	}
+	ur.body = resp.Body
+	return nil
+}
+
+func (ur *URLReader) Read(p []byte) (int, error) {
+	n, err := ur.body.Read(p)
+	ur.n += int64(n)
+	if err == io.EOF && ur.Size >= 0 && ur.n < ur.Size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil || err == io.EOF || !ur.resumable() {
+		return n, err
+	}
+	ur.body.Close()
+	ur.Retries--
+	select {
+	case <-ur.ctx.Done():
+		return n, ur.ctx.Err()
+	case <-time.After(FetchRetryDelay):
+	}
+	if rerr := ur.get(); rerr != nil {
+		ur.body = ioutil.NopCloser(errReader{rerr})
+		return n, rerr
+	}
+	return n, nil
+}
+
+// A failed download can be resumed if there are retries left, and the
+// server gave a validator to check that the resource is unchanged.
+func (ur *URLReader) resumable() bool {
+	return ur.Retries > 0 && ur.validator != "" && ur.ctx.Err() == nil
+}
+
+func (ur *URLReader) Close() error {
+	return ur.body.Close()
+}
+
+// errReader fails every read with err.
+type errReader struct {
+	err error
+}
+
+func (er errReader) Read(p []byte) (int, error) {
+	return 0, er.err
+}
@@ -0,0 +1,115 @@
+package sponge
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// FrameFormats lists the framings understood by NewFrameReader.
+var FrameFormats = []string{"length", "netstring"}
+
+// FrameReader splits a stream into frames, each preceded by its length.
+// A frame cut short by the end of the stream fails with
+// io.ErrUnexpectedEOF, so it is never mistaken for a whole one.
+type FrameReader struct {
+	br        *bufio.Reader
+	netstring bool
+}
+
+// NewFrameReader returns a reader for the frames in r.  The format is
+// "length", where each frame follows its length as 4 bytes in big-endian
+// order, or "netstring", like 5:hello,.
+func NewFrameReader(r io.Reader, format string) (*FrameReader, error) {
+	switch format {
+	case "length", "netstring":
+	default:
+		return nil, fmt.Errorf("Unknown framing %q.", format)
+	}
+	return &FrameReader{br: bufio.NewReaderSize(r, READSIZE), netstring: format == "netstring"}, nil
+}
+
+// Next returns a reader for the next frame, or io.EOF when the stream
+// ends between frames.  Each frame must be read to its end before
+// calling Next again.
+func (fr *FrameReader) Next() (io.Reader, error) {
+	var size int64
+	var err error
+	if fr.netstring {
+		size, err = fr.netstringLength()
+	} else {
+		var hdr [4]byte
+		if _, err = io.ReadFull(fr.br, hdr[:]); err == nil {
+			size = int64(binary.BigEndian.Uint32(hdr[:]))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &frame{br: fr.br, left: size, trailer: fr.netstring}, nil
+}
+
+// Reads a netstring's length and its colon.
+func (fr *FrameReader) netstringLength() (int64, error) {
+	size := int64(0)
+	for digits := 0; ; digits++ {
+		b, err := fr.br.ReadByte()
+		if err == io.EOF && digits > 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case b == ':' && digits > 0:
+			return size, nil
+		case b < '0' || b > '9':
+			return 0, fmt.Errorf("Invalid netstring length, found %q.", b)
+		case digits > 0 && size == 0:
+			return 0, errors.New("Invalid netstring length with a leading zero.")
+		case digits >= 18:
+			return 0, errors.New("Netstring length is too long.")
+		}
+		size = size*10 + int64(b-'0')
+	}
+}
+
+// frame reads one frame from a FrameReader.
+type frame struct {
+	br   *bufio.Reader
+	left int64
+	// Whether a netstring's closing comma is still to be read.
+	trailer bool
+}
+
+func (f *frame) Read(p []byte) (int, error) {
+	if f.left == 0 {
+		if !f.trailer {
+			return 0, io.EOF
+		}
+		// The frame only ends once its comma is seen.
+		b, err := f.br.ReadByte()
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		if b != ',' {
+			return 0, fmt.Errorf("Netstring ends with %q instead of ','.", b)
+		}
+		f.trailer = false
+		return 0, io.EOF
+	}
+	if int64(len(p)) > f.left {
+		p = p[:f.left]
+	}
+	n, err := f.br.Read(p)
+	f.left -= int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package sponge
+
+import (
+	"os"
+)
+
+// SyncDir flushes the directory dir to storage, making renames within
+// it durable.
+func SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if err1 := d.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
@@ -0,0 +1,8 @@
+package sponge
+
+// SyncDir does nothing, because Windows cannot open directories for
+// flushing.  MoveFileEx's write-through flag makes replacements durable
+// instead.
+func SyncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,225 @@
+package sponge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2/google"
+)
+
+// GCSChunkSize is how much of an object each request of a resumable
+// upload sends.  It must be a multiple of 256K.
+var GCSChunkSize int64 = 16 << 20
+
+// GCSRetries is how many times a resumable upload recovers from failed
+// requests before giving up.
+var GCSRetries = 3
+
+// GCSUploader uploads to a Google Cloud Storage object with a resumable
+// upload.  The object is only created when the upload is finalized by its
+// last chunk, and a failed upload is cancelled.  Credentials come from
+// Application Default Credentials, unless STORAGE_EMULATOR_HOST names an
+// emulator.
+type GCSUploader struct {
+	Bucket string
+	Object string
+}
+
+// NewGCSUploader returns an uploader for a URL like gs://bucket/object.
+func NewGCSUploader(u *url.URL) (*GCSUploader, error) {
+	object := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || object == "" || strings.HasSuffix(object, "/") {
+		return nil, fmt.Errorf("Invalid GCS destination %q, expected gs://BUCKET/OBJECT.", u.String())
+	}
+	return &GCSUploader{Bucket: u.Host, Object: object}, nil
+}
+
+func (gu *GCSUploader) Upload(ctx context.Context, r io.ReadSeeker, size int64) error {
+	client, endpoint, err := gcsClient(ctx)
+	if err != nil {
+		return err
+	}
+	session, err := gu.start(ctx, client, endpoint, size)
+	if err != nil {
+		return err
+	}
+	if err := gu.send(ctx, client, session, r, size); err != nil {
+		gu.cancel(client, session)
+		return err
+	}
+	return nil
+}
+
+// Returns an HTTP client carrying credentials, and the endpoint to use.
+func gcsClient(ctx context.Context) (*http.Client, string, error) {
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+		return http.DefaultClient, strings.TrimSuffix(host, "/"), nil
+	}
+	client, err := google.DefaultClient(ctx, "https://www.googleapis.com/auth/devstorage.read_write")
+	if err != nil {
+		return nil, "", err
+	}
+	return client, "https://storage.googleapis.com", nil
+}
+
+// Starts a resumable upload, returning its session URI.
+func (gu *GCSUploader) start(ctx context.Context, client *http.Client, endpoint string, size int64) (string, error) {
+	q := url.Values{"uploadType": {"resumable"}, "name": {gu.Object}}
+	u := endpoint + "/upload/storage/v1/b/" + url.PathEscape(gu.Bucket) + "/o?" + q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(size, 10))
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", gu.error(resp)
+	}
+	session := resp.Header.Get("Location")
+	if session == "" {
+		return "", fmt.Errorf("Cannot upload to %s: no upload session.", gu)
+	}
+	return session, nil
+}
+
+// Sends r in chunks.  After a failed request it asks how much arrived,
+// and carries on from there.
+func (gu *GCSUploader) send(ctx context.Context, client *http.Client, session string, r io.ReadSeeker, size int64) error {
+	var offset int64
+	retries := GCSRetries
+	for {
+		n := size - offset
+		if n > GCSChunkSize {
+			n = GCSChunkSize
+		}
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, session, io.LimitReader(r, n))
+		if err != nil {
+			return err
+		}
+		req.ContentLength = n
+		if n == 0 {
+			req.Body = http.NoBody
+			req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		} else {
+			req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+n-1, size))
+		}
+		done, next, err := gu.progress(client.Do(req))
+		if done {
+			return nil
+		}
+		if err == nil {
+			offset = next
+			continue
+		}
+		if retries == 0 || ctx.Err() != nil || !transient(err) {
+			return err
+		}
+		retries--
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(FetchRetryDelay):
+		}
+		// Asks how much of the object has arrived.
+		req, err = http.NewRequestWithContext(ctx, http.MethodPut, session, http.NoBody)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		done, next, err = gu.progress(client.Do(req))
+		if done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		offset = next
+	}
+}
+
+// gcsError is a failed request.  Server errors are worth retrying.
+type gcsError struct {
+	msg    string
+	status int
+}
+
+func (e *gcsError) Error() string {
+	return e.msg
+}
+
+func transient(err error) bool {
+	if ge, ok := err.(*gcsError); ok {
+		return ge.status >= 500 || ge.status == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// Interprets a response to a chunk: whether the upload is finished, and
+// if not, the offset of the next chunk.
+func (gu *GCSUploader) progress(resp *http.Response, err error) (bool, int64, error) {
+	if err != nil {
+		return false, 0, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return true, 0, nil
+	case http.StatusPermanentRedirect:
+		// Range says which bytes have arrived, like "bytes=0-1023".
+		rng := resp.Header.Get("Range")
+		if rng == "" {
+			return false, 0, nil
+		}
+		i := strings.LastIndex(rng, "-")
+		last, err := strconv.ParseInt(rng[i+1:], 10, 64)
+		if i < 0 || err != nil {
+			return false, 0, fmt.Errorf("Cannot upload to %s: bad range %q.", gu, rng)
+		}
+		return false, last + 1, nil
+	}
+	return false, 0, gu.error(resp)
+}
+
+func (gu *GCSUploader) error(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	msg := fmt.Sprintf("Cannot upload to %s: %s.", gu, resp.Status)
+	if len(body) > 0 {
+		msg = fmt.Sprintf("Cannot upload to %s: %s: %s", gu, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return &gcsError{msg, resp.StatusCode}
+}
+
+// Cancels the upload session so that it is never finalized.
+func (gu *GCSUploader) cancel(client *http.Client, session string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, session, nil)
+	if err != nil {
+		return
+	}
+	if resp, err := client.Do(req); err == nil {
+		resp.Body.Close()
+	}
+}
+
+func (gu *GCSUploader) String() string {
+	return "gs://" + gu.Bucket + "/" + gu.Object
+}
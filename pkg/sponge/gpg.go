@@ -0,0 +1,103 @@
+package sponge
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// LoadKeyring reads OpenPGP public keys from fn, which may be armored or
+// binary.
+func LoadKeyring(fn string) (openpgp.EntityList, error) {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN")) {
+		return openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	}
+	return openpgp.ReadKeyRing(bufio.NewReader(bytes.NewReader(data)))
+}
+
+// FindGPGRecipient finds the key in keyring matching id, which is a key
+// ID or fingerprint in hex, or part of a user ID such as an email
+// address.  The match must be unique.
+func FindGPGRecipient(keyring openpgp.EntityList, id string) (*openpgp.Entity, error) {
+	hexID := strings.ToUpper(strings.TrimPrefix(strings.Replace(id, " ", "", -1), "0x"))
+	var found *openpgp.Entity
+	for _, e := range keyring {
+		if !gpgKeyMatches(e, hexID, id) {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("OpenPGP key %q is ambiguous.", id)
+		}
+		found = e
+	}
+	if found == nil {
+		return nil, fmt.Errorf("No OpenPGP key matches %q.", id)
+	}
+	return found, nil
+}
+
+func gpgKeyMatches(e *openpgp.Entity, hexID, id string) bool {
+	fingerprint := strings.ToUpper(hex.EncodeToString(e.PrimaryKey.Fingerprint))
+	if len(hexID) >= 8 && strings.HasSuffix(fingerprint, hexID) {
+		return true
+	}
+	for _, sub := range e.Subkeys {
+		if len(hexID) >= 8 && strings.HasSuffix(strings.ToUpper(hex.EncodeToString(sub.PublicKey.Fingerprint)), hexID) {
+			return true
+		}
+	}
+	for name := range e.Identities {
+		if strings.Contains(strings.ToLower(name), strings.ToLower(id)) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewGPGSponge wraps sf so the data it receives is encrypted to
+// recipients with OpenPGP, ASCII armored if armored is set.  The
+// encrypted data cannot be replayed.
+func NewGPGSponge(sf SpongeFile, recipients []*openpgp.Entity, armored bool) SpongeFile {
+	return &EncodingSponge{
+		Sponge: sf,
+		NewEncoder: func(w io.Writer) (io.WriteCloser, error) {
+			if !armored {
+				return openpgp.Encrypt(w, recipients, nil, nil, nil)
+			}
+			aw, err := armor.Encode(w, "PGP MESSAGE", nil)
+			if err != nil {
+				return nil, err
+			}
+			ew, err := openpgp.Encrypt(aw, recipients, nil, nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			return &stackedWriter{ew, aw}, nil
+		},
+	}
+}
+
+// stackedWriter writes to the first writer and closes them all in order.
+type stackedWriter struct {
+	io.WriteCloser
+	outer io.Closer
+}
+
+func (sw *stackedWriter) Close() error {
+	err := sw.WriteCloser.Close()
+	if err1 := sw.outer.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package sponge
+
+import (
+	"context"
+	"io"
+)
+
+// HybridSponge accumulates data in memory until it exceeds MaxMemory,
+// and then spills it to a scratch file.  Either way the target is
+// replaced atomically.
+type HybridSponge struct {
+	Writer    SpongeFile
+	Data      []byte
+	MaxMemory int
+	Spilled   bool
+	ctx       context.Context
+}
+
+// NewHybridSponge returns a sponge which holds up to maxMemory bytes in
+// memory before switching to a scratch file.
+func NewHybridSponge(targetFn string, maxMemory int, opts Options) SpongeFile {
+	return &HybridSponge{
+		Writer:    NewAtomicSponge(targetFn, opts),
+		Data:      make([]byte, 0, READSIZE),
+		MaxMemory: maxMemory,
+	}
+}
+
+func (hs *HybridSponge) Begin(ctx context.Context) error {
+	hs.ctx = ctx
+	return nil
+}
+
+func (hs *HybridSponge) Write(d []byte) error {
+	if hs.Spilled {
+		return hs.Writer.Write(d)
+	}
+	if len(hs.Data)+len(d) <= hs.MaxMemory {
+		hs.Data = append(hs.Data, d...)
+		return nil
+	}
+	if err := hs.spill(); err != nil {
+		return err
+	}
+	return hs.Writer.Write(d)
+}
+
+// Moves the accumulated data into the scratch file.
+func (hs *HybridSponge) spill() error {
+	if err := hs.Writer.Begin(hs.ctx); err != nil {
+		return err
+	}
+	hs.Spilled = true
+	if err := hs.Writer.Write(hs.Data); err != nil {
+		return err
+	}
+	hs.Data = nil
+	return nil
+}
+
+func (hs *HybridSponge) Abort() error {
+	return hs.Writer.Abort()
+}
+
+func (hs *HybridSponge) Complete(ctx context.Context) error {
+	if !hs.Spilled {
+		hintSize(hs.Writer, int64(len(hs.Data)))
+		if err := hs.spill(); err != nil {
+			return err
+		}
+	}
+	return hs.Writer.Complete(ctx)
+}
+
+func (hs *HybridSponge) Cleanup() error {
+	return hs.Writer.Cleanup()
+}
+
+func (hs *HybridSponge) Replay(w io.Writer) error {
+	return replay(hs.Writer, w)
+}
+
+func (hs *HybridSponge) Changed() bool {
+	return changed(hs.Writer)
+}
+
+func (hs *HybridSponge) ScratchFn() string {
+	return ScratchFn(hs.Writer)
+}
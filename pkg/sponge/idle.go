@@ -0,0 +1,28 @@
+package sponge
+
+import (
+	"io"
+	"time"
+)
+
+// IdleReader returns a reader which calls expire once no data has come
+// from r for timeout.  Pair it with InterruptibleReader to cut blocked
+// reads off.  Call the returned function to stop the timer.
+func IdleReader(r io.Reader, timeout time.Duration, expire func()) (io.Reader, func() bool) {
+	ir := &idleReader{r: r, timeout: timeout, timer: time.AfterFunc(timeout, expire)}
+	return ir, ir.timer.Stop
+}
+
+type idleReader struct {
+	r       io.Reader
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+func (ir *idleReader) Read(p []byte) (int, error) {
+	n, err := ir.r.Read(p)
+	if n > 0 {
+		ir.timer.Reset(ir.timeout)
+	}
+	return n, err
+}
@@ -0,0 +1,214 @@
+package sponge
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// InPlaceSponge accumulates data in a scratch file, and then writes it
+// over the target's existing contents instead of replacing the target,
+// so that it keeps its inode.  Hard links, bind mounts, and tools
+// watching the inode all see the new data.  The write is not atomic:
+// readers may see it half done, although it is flushed to storage before
+// Complete returns.
+type InPlaceSponge struct {
+	TargetFn   string
+	TempDir    string
+	TempName   string
+	SpongeFn   string
+	Sponge     *os.File
+	LeaveDirty bool
+	Append     bool
+	// SkipUnchanged leaves identical targets alone, and Unchanged
+	// records that this happened.
+	SkipUnchanged bool
+	Unchanged     bool
+	Verify        func(ctx context.Context, fn string) error
+	Precondition  func() error
+	CheckSpace    bool
+	FallbackFn    string
+	Mode          ModeFunc
+	Metadata      []MetadataFunc
+	// Unnamed sponges are created with O_TMPFILE where possible.
+	Unnamed bool
+	// opts are kept for saving the data in FallbackFn.
+	opts Options
+}
+
+// NewInPlaceSponge returns a sponge which overwrites targetFn in place.
+func NewInPlaceSponge(targetFn string, opts Options) SpongeFile {
+	return &InPlaceSponge{
+		TargetFn:   targetFn,
+		TempDir:    TempDir(opts.TempDir, targetFn),
+		TempName:   opts.TempName,
+		LeaveDirty: opts.LeaveDirty,
+		Append:     opts.Append,
+
+		SkipUnchanged: opts.SkipUnchanged,
+		Verify:        opts.Verify,
+		Precondition:  opts.Precondition,
+		CheckSpace:    opts.CheckSpace,
+		FallbackFn:    opts.FallbackFn,
+		Mode:          opts.Mode,
+		Metadata:      opts.Metadata,
+		opts:          opts,
+	}
+}
+
+func (ps *InPlaceSponge) Begin(ctx context.Context) error {
+	if !ps.LeaveDirty {
+		if sponge, err := openTmpFile(ps.TempDir); err == nil {
+			ps.Sponge = sponge
+			ps.SpongeFn = sponge.Name()
+			ps.Unnamed = true
+			return nil
+		}
+	}
+	sponge, err := createTemp(ps.TempDir, ps.TempName)
+	if readOnly(err) && ps.FallbackFn != "" && ps.TempDir != filepath.Dir(ps.FallbackFn) {
+		// The data is gathered beside the fallback, in case it ends up
+		// there.
+		ps.TempDir = filepath.Dir(ps.FallbackFn)
+		return ps.Begin(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	ps.Sponge = sponge
+	ps.SpongeFn = sponge.Name()
+	return nil
+}
+
+func (ps *InPlaceSponge) Abort() error {
+	return nil
+}
+
+func (ps *InPlaceSponge) Write(d []byte) error {
+	return writeAll(ps.Sponge, d)
+}
+
+// ReadFrom copies r into the sponge, letting the kernel copy from files
+// where it can.
+func (ps *InPlaceSponge) ReadFrom(r io.Reader) (int64, error) {
+	if fileSource(r) {
+		return ps.Sponge.ReadFrom(r)
+	}
+	return copyBuffered(ps.Sponge, r)
+}
+
+func (ps *InPlaceSponge) Complete(ctx context.Context) error {
+	size, err := ps.Sponge.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if ps.Verify != nil {
+		if err := ps.Verify(ctx, ps.SpongeFn); err != nil {
+			return err
+		}
+	}
+	if ps.SkipUnchanged {
+		same := ps.Append && size == 0
+		if !ps.Append {
+			if same, err = SameFileContents(ps.SpongeFn, ps.TargetFn); err != nil {
+				return err
+			}
+		}
+		if same {
+			ps.Unchanged = true
+			return nil
+		}
+	}
+	if ps.Precondition != nil {
+		if err := ps.Precondition(); err != nil {
+			return err
+		}
+	}
+	if ps.CheckSpace {
+		if err := CheckSpace(filepath.Dir(ps.TargetFn), growth(ps.TargetFn, size, ps.Append)); err != nil {
+			return err
+		}
+	}
+	fi, err := os.Stat(ps.TargetFn)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	mode := DEFAULT_MODE
+	if err == nil {
+		mode = fi.Mode()
+	}
+	if err := ps.overwrite(size, mode, fi == nil || fi.Mode().IsRegular()); err != nil {
+		if _, serr := ps.Sponge.Seek(0, io.SeekStart); serr != nil {
+			return err
+		}
+		return saveFallback(ctx, ps.TargetFn, ps.opts, io.LimitReader(ps.Sponge, size), err)
+	}
+	if err := applyMetadata(ps.Metadata, ps.TargetFn, ps.TargetFn, fi); err != nil {
+		return err
+	}
+	if ps.Mode != nil {
+		return os.Chmod(ps.TargetFn, newMode(mode, ps.Mode))
+	}
+	return nil
+}
+
+// Writes the sponge's size bytes over the target, or after it when
+// appending, and trims anything left beyond them.  Once begun the write
+// is finished even if interrupted, since stopping would leave the target
+// half written.
+func (ps *InPlaceSponge) overwrite(size int64, mode os.FileMode, truncate bool) error {
+	if _, err := ps.Sponge.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	flag := os.O_WRONLY | os.O_CREATE
+	if ps.Append {
+		flag |= os.O_APPEND
+	}
+	target, err := os.OpenFile(ps.TargetFn, flag, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(target, io.LimitReader(ps.Sponge, size))
+	if err == nil && truncate && !ps.Append {
+		err = target.Truncate(size)
+	}
+	if err == nil {
+		err = target.Sync()
+	}
+	if cerr := target.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (ps *InPlaceSponge) ScratchFn() string {
+	return ps.SpongeFn
+}
+
+func (ps *InPlaceSponge) Changed() bool {
+	return !ps.Unchanged
+}
+
+func (ps *InPlaceSponge) Cleanup() error {
+	if ps.Sponge != nil {
+		ps.Sponge.Close()
+		ps.Sponge = nil
+	}
+	if ps.Unnamed || ps.LeaveDirty || ps.SpongeFn == "" {
+		return nil
+	}
+	return removeFile(ps.SpongeFn)
+}
+
+// Replay writes the new data from the sponge.
+func (ps *InPlaceSponge) Replay(w io.Writer) error {
+	if _, err := ps.Sponge.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.Copy(w, ps.Sponge)
+	return err
+}
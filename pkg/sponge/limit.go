@@ -0,0 +1,31 @@
+package sponge
+
+import (
+	"fmt"
+	"io"
+)
+
+// SizeCheckedReader passes r through, but fails once more than max bytes
+// have been read, or at its end if fewer than min were.  A max of zero
+// or less is unlimited.
+func SizeCheckedReader(r io.Reader, min, max int64) io.Reader {
+	return &sizeCheckedReader{r: r, min: min, max: max}
+}
+
+type sizeCheckedReader struct {
+	r        io.Reader
+	min, max int64
+	n        int64
+}
+
+func (sr *sizeCheckedReader) Read(p []byte) (int, error) {
+	n, err := sr.r.Read(p)
+	sr.n += int64(n)
+	if sr.max > 0 && sr.n > sr.max {
+		return n, fmt.Errorf("Input has more than the maximum of %d bytes.", sr.max)
+	}
+	if err == io.EOF && sr.n < sr.min {
+		return n, fmt.Errorf("Input has only %d bytes, fewer than the minimum of %d.", sr.n, sr.min)
+	}
+	return n, err
+}
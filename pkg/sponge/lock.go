@@ -0,0 +1,102 @@
+package sponge
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LockPollInterval is how often a lock held by someone else is tried
+// again.
+var LockPollInterval = 50 * time.Millisecond
+
+// Lock is an exclusive advisory lock on a file, such as a sidecar
+// beside a destination, held with flock or LockFileEx, or a lock
+// directory.
+type Lock struct {
+	Fn string
+	f  *os.File
+	// For lock directories, the holder's record and its refresher.
+	owner   string
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// LockFileName expands the lock filename template for targetFn, using
+// the placeholders {file}, {dir}, {base}, {name}, and {ext} of backup
+// templates.
+func LockFileName(template, targetFn string) (string, error) {
+	return ExpandTemplate(template, staticPlaceholders(targetFn))
+}
+
+// AcquireLock locks fn, creating it if it is missing, waiting for anyone
+// else holding it until ctx is done.  A file replaced while waiting for
+// it, as by another spunge committing it, is locked afresh.
+func AcquireLock(ctx context.Context, fn string) (*Lock, error) {
+	return acquireLock(ctx, fn, os.O_RDWR|os.O_CREATE)
+}
+
+// AcquireExistingLock is AcquireLock for a file which must already
+// exist, such as a destination locked itself.  It fails with an error
+// satisfying os.IsNotExist rather than create fn.
+func AcquireExistingLock(ctx context.Context, fn string) (*Lock, error) {
+	return acquireLock(ctx, fn, os.O_RDONLY)
+}
+
+// Locks fn, opened with flag.
+func acquireLock(ctx context.Context, fn string, flag int) (*Lock, error) {
+	for {
+		f, err := os.OpenFile(fn, flag, DEFAULT_MODE)
+		if err != nil {
+			return nil, err
+		}
+		locked, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if locked {
+			if current, err := os.Stat(fn); err == nil && sameFile(f, current) {
+				return &Lock{Fn: fn, f: f}, nil
+			}
+			// Locked the file just as it was replaced, so lock its successor.
+			unlock(f)
+			f.Close()
+			continue
+		}
+		f.Close()
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, fmt.Errorf("Timed out waiting for the lock on %s.", fn)
+			}
+			return nil, ctx.Err()
+		case <-time.After(LockPollInterval):
+		}
+	}
+}
+
+// Release unlocks the file.  The lock file itself is left in place,
+// since removing it would let two writers lock different files.  A lock
+// directory is removed, unless it has been broken and taken by another.
+func (l *Lock) Release() error {
+	if l.f == nil {
+		close(l.stop)
+		<-l.stopped
+		owner, err := ioutil.ReadFile(filepath.Join(l.Fn, lockOwnerFn))
+		if err != nil || string(owner) != l.owner {
+			return fmt.Errorf("Lost the lock on %s.", l.Fn)
+		}
+		return os.RemoveAll(l.Fn)
+	}
+	unlock(l.f)
+	return l.f.Close()
+}
+
+func sameFile(f *os.File, fi os.FileInfo) bool {
+	held, err := f.Stat()
+	return err == nil && os.SameFile(held, fi)
+}
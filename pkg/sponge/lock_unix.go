@@ -0,0 +1,35 @@
+//go:build !windows
+
+package sponge
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// tryLock takes an exclusive flock on f, reporting false if someone else
+// holds one.
+func tryLock(f *os.File) (bool, error) {
+	for {
+		err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+		switch err {
+		case nil:
+			return true, nil
+		case unix.EINTR:
+			continue
+		case unix.EWOULDBLOCK:
+			return false, nil
+		}
+		return false, err
+	}
+}
+
+func unlock(f *os.File) {
+	unix.Flock(int(f.Fd()), unix.LOCK_UN)
+}
+
+// processAlive reports whether the process pid exists.
+func processAlive(pid int) bool {
+	return unix.Kill(pid, 0) != unix.ESRCH
+}
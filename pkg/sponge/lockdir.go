@@ -0,0 +1,138 @@
+package sponge
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLockStale is how long a lock directory may go without its
+// holder refreshing it before others take it over.
+const DefaultLockStale = 5 * time.Minute
+
+// MinLockStale is the shortest staleness AcquireLockDir allows, since
+// the lock is refreshed by touching a file whose times may only have
+// second resolution.
+const MinLockStale = time.Second
+
+// lockOwnerFn names the file in a lock directory recording its holder.
+const lockOwnerFn = "owner"
+
+// AcquireLockDir locks by creating the directory fn, which is atomic even
+// on NFS, where flock may not reach other hosts.  It waits for anyone else
+// holding it until ctx is done.  The holder's host and pid are recorded
+// inside, and refreshed every so often; a lock whose holder has died on
+// this host, or which has gone stale longer than stale, is broken.
+// Stale is at least MinLockStale.
+func AcquireLockDir(ctx context.Context, fn string, stale time.Duration) (*Lock, error) {
+	if stale < MinLockStale {
+		stale = MinLockStale
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	owner := fmt.Sprintf("%s %d %s\n", host, os.Getpid(), strconv.FormatUint(rand.Uint64(), 36))
+	for {
+		err := os.Mkdir(fn, 0777)
+		if err == nil {
+			if err := writeLockOwner(fn, owner); err != nil {
+				os.RemoveAll(fn)
+				return nil, err
+			}
+			l := &Lock{Fn: fn, owner: owner, stop: make(chan struct{}), stopped: make(chan struct{})}
+			go l.refresh(stale / 4)
+			return l, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if fi, err := os.Stat(fn); err == nil && !fi.IsDir() {
+			return nil, fmt.Errorf("%s exists and is not a lock directory.", fn)
+		}
+		if breakStaleLock(fn, host, stale) {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, fmt.Errorf("Timed out waiting for the lock on %s.", fn)
+			}
+			return nil, ctx.Err()
+		case <-time.After(LockPollInterval):
+		}
+	}
+}
+
+// Writes the owner's record into the lock directory fn.
+func writeLockOwner(fn, owner string) error {
+	return ioutil.WriteFile(filepath.Join(fn, lockOwnerFn), []byte(owner), 0666)
+}
+
+// Keeps the lock fresh until it is released, so that others don't break
+// it during a long run.
+func (l *Lock) refresh(every time.Duration) {
+	defer close(l.stopped)
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case now := <-t.C:
+			os.Chtimes(filepath.Join(l.Fn, lockOwnerFn), now, now)
+		}
+	}
+}
+
+// Removes the lock directory fn if its holder is gone, reporting whether
+// it did.  A lock directory without an owner may be one just being
+// created, so only age breaks it.
+func breakStaleLock(fn, host string, stale time.Duration) bool {
+	ownerFn := filepath.Join(fn, lockOwnerFn)
+	fi, err := os.Stat(ownerFn)
+	if os.IsNotExist(err) {
+		fi, err = os.Stat(fn)
+	}
+	if err != nil {
+		return false
+	}
+	owner, _ := ioutil.ReadFile(ownerFn)
+	if !lockHolderGone(string(owner), host) && time.Since(fi.ModTime()) < stale {
+		return false
+	}
+	// Move the lock aside before removing it, so that racing breakers
+	// remove it once, and check it is still the one found stale.
+	aside := fmt.Sprintf("%s.stale%s", fn, strconv.FormatUint(rand.Uint64(), 36))
+	if err := os.Rename(fn, aside); err != nil {
+		return false
+	}
+	moved, _ := ioutil.ReadFile(filepath.Join(aside, lockOwnerFn))
+	if string(moved) != string(owner) {
+		// Someone else broke it and took it first, so put theirs back.
+		os.Rename(aside, fn)
+		return false
+	}
+	os.RemoveAll(aside)
+	return true
+}
+
+// Reports whether the holder recorded in owner was a process on this
+// host which has since exited.
+func lockHolderGone(owner, host string) bool {
+	fields := strings.Fields(owner)
+	if len(fields) < 2 || fields[0] != host {
+		return false
+	}
+	pid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return false
+	}
+	return !processAlive(pid)
+}
@@ -0,0 +1,188 @@
+package sponge
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// archiveRewriter copies the archive old to w, replacing member with the
+// first size bytes of data, or adding it if it is missing.  Old is nil
+// when there is no archive yet.
+type archiveRewriter func(w io.Writer, old *os.File, member string, data io.ReadSeeker, size int64) error
+
+// archiveFormats maps archive filename suffixes to their rewriters.
+var archiveFormats = []struct {
+	suffix  string
+	rewrite archiveRewriter
+}{
+	{".tar", rewriteTar},
+	{".tar.gz", rewriteTarGz},
+	{".tgz", rewriteTarGz},
+	{".zip", rewriteZip},
+}
+
+// SplitMember splits a destination like archive.tar::path/inside into the
+// archive and the member's name.  It reports false for other
+// destinations.
+func SplitMember(target string) (string, string, bool) {
+	i := strings.Index(target, "::")
+	if i <= 0 || i+2 == len(target) {
+		return "", "", false
+	}
+	return target[:i], target[i+2:], true
+}
+
+// MemberSponge accumulates the data for a member of an archive, and then
+// rewrites the archive with that member replaced or added.  The rewritten
+// archive goes through an AtomicSponge, so it replaces the old one
+// atomically and keeps its mode.
+type MemberSponge struct {
+	ArchiveFn  string
+	Member     string
+	TempDir    string
+	TempName   string
+	LeaveDirty bool
+	SpongeFn   string
+	Sponge     *os.File
+	// Options for writing the archive.
+	Options Options
+	rewrite archiveRewriter
+	archive SpongeFile
+}
+
+// NewMemberSponge returns a sponge which writes member of the archive
+// archiveFn.  The archive's format comes from its suffix.
+func NewMemberSponge(archiveFn, member string, opts Options) (SpongeFile, error) {
+	var rewrite archiveRewriter
+	for _, f := range archiveFormats {
+		if strings.HasSuffix(archiveFn, f.suffix) {
+			rewrite = f.rewrite
+		}
+	}
+	if rewrite == nil {
+		return nil, fmt.Errorf("Unsupported archive %q.", archiveFn)
+	}
+	member = path.Clean(strings.TrimPrefix(member, "/"))
+	if member == "." || member == ".." || strings.HasPrefix(member, "../") {
+		return nil, fmt.Errorf("Invalid archive member %q.", member)
+	}
+	return &MemberSponge{
+		ArchiveFn:  archiveFn,
+		Member:     member,
+		TempDir:    TempDir(opts.TempDir, archiveFn),
+		TempName:   opts.TempName,
+		LeaveDirty: opts.LeaveDirty,
+		Options: Options{
+			TempDir:       opts.TempDir,
+			TempName:      opts.TempName,
+			LeaveDirty:    opts.LeaveDirty,
+			Fsync:         opts.Fsync,
+			SkipUnchanged: opts.SkipUnchanged,
+			Verify:        opts.Verify,
+			Mode:          opts.Mode,
+			Metadata:      opts.Metadata,
+			Precondition:  opts.Precondition,
+			CheckSpace:    opts.CheckSpace,
+			FallbackFn:    opts.FallbackFn,
+			Warn:          opts.Warn,
+		},
+		rewrite: rewrite,
+	}, nil
+}
+
+func (ms *MemberSponge) Begin(ctx context.Context) error {
+	sponge, err := createTemp(ms.TempDir, ms.TempName)
+	if err != nil {
+		return err
+	}
+	ms.Sponge = sponge
+	ms.SpongeFn = sponge.Name()
+	return nil
+}
+
+func (ms *MemberSponge) Abort() error {
+	return nil
+}
+
+func (ms *MemberSponge) Write(d []byte) error {
+	n, err := ms.Sponge.Write(d)
+	if err != nil {
+		return err
+	}
+	if n < len(d) {
+		return io.ErrShortWrite
+	}
+	return nil
+}
+
+func (ms *MemberSponge) Complete(ctx context.Context) error {
+	size, err := ms.Sponge.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := ms.Sponge.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	old, err := os.Open(ms.ArchiveFn)
+	if os.IsNotExist(err) {
+		old = nil
+	} else if err != nil {
+		return err
+	} else {
+		defer old.Close()
+	}
+	ms.archive = NewAtomicSponge(ms.ArchiveFn, ms.Options)
+	if err := ms.archive.Begin(ctx); err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(spongeWriter{ms.archive}, READSIZE)
+	if err := ms.rewrite(w, old, ms.Member, ms.Sponge, size); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return ms.archive.Complete(ctx)
+}
+
+// ScratchFn names the rewritten archive once there is one, and before
+// that the member's data.
+func (ms *MemberSponge) ScratchFn() string {
+	if ms.archive != nil {
+		return ScratchFn(ms.archive)
+	}
+	return ms.SpongeFn
+}
+
+func (ms *MemberSponge) Changed() bool {
+	return ms.archive == nil || changed(ms.archive)
+}
+
+func (ms *MemberSponge) Cleanup() error {
+	if ms.archive != nil {
+		ms.archive.Cleanup()
+	}
+	if ms.Sponge == nil {
+		return nil
+	}
+	ms.Sponge.Close()
+	ms.Sponge = nil
+	if ms.LeaveDirty {
+		return nil
+	}
+	return removeFile(ms.SpongeFn)
+}
+
+// Replay writes the member's data to w.
+func (ms *MemberSponge) Replay(w io.Writer) error {
+	if _, err := ms.Sponge.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.Copy(w, ms.Sponge)
+	return err
+}
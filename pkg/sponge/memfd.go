@@ -0,0 +1,101 @@
+package sponge
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// MemfdSponge accumulates data in an anonymous memory file instead of
+// the Go heap, then seals it and copies it into place atomically using
+// an AtomicSponge.  Only Linux has memory files.
+type MemfdSponge struct {
+	Writer SpongeFile
+	Memfd  *os.File
+}
+
+// NewMemfdSponge returns a memory file sponge which replaces targetFn
+// atomically.
+func NewMemfdSponge(targetFn string, opts Options) SpongeFile {
+	return &MemfdSponge{
+		Writer: NewAtomicSponge(targetFn, opts),
+	}
+}
+
+func (ms *MemfdSponge) Begin(ctx context.Context) error {
+	memfd, err := createMemfd("spunge")
+	if err != nil {
+		return err
+	}
+	ms.Memfd = memfd
+	return nil
+}
+
+func (ms *MemfdSponge) Write(d []byte) error {
+	return writeAll(ms.Memfd, d)
+}
+
+// ReadFrom copies r into the memory file, letting the kernel copy from
+// files where it can.
+func (ms *MemfdSponge) ReadFrom(r io.Reader) (int64, error) {
+	if fileSource(r) {
+		return ms.Memfd.ReadFrom(r)
+	}
+	return copyBuffered(ms.Memfd, r)
+}
+
+func (ms *MemfdSponge) Abort() error {
+	return ms.Writer.Abort()
+}
+
+// Complete seals the memory file against further changes, and then
+// copies it into the scratch file with copy_file_range where possible.
+func (ms *MemfdSponge) Complete(ctx context.Context) error {
+	if err := sealMemfd(ms.Memfd); err != nil {
+		return err
+	}
+	fi, err := ms.Memfd.Stat()
+	if err != nil {
+		return err
+	}
+	hintSize(ms.Writer, fi.Size())
+	if err := ms.Writer.Begin(ctx); err != nil {
+		return err
+	}
+	if _, err := ms.Memfd.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if rf, ok := ms.Writer.(io.ReaderFrom); ok {
+		_, err = rf.ReadFrom(ms.Memfd)
+	} else {
+		_, err = io.Copy(spongeWriter{ms.Writer}, ContextReader(ctx, ms.Memfd))
+	}
+	if err != nil {
+		return err
+	}
+	return ms.Writer.Complete(ctx)
+}
+
+func (ms *MemfdSponge) Cleanup() error {
+	if ms.Memfd != nil {
+		ms.Memfd.Close()
+		ms.Memfd = nil
+	}
+	return ms.Writer.Cleanup()
+}
+
+func (ms *MemfdSponge) Changed() bool {
+	return changed(ms.Writer)
+}
+
+func (ms *MemfdSponge) ScratchFn() string {
+	return ScratchFn(ms.Writer)
+}
+
+func (ms *MemfdSponge) Replay(w io.Writer) error {
+	if _, err := ms.Memfd.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.Copy(w, ms.Memfd)
+	return err
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package sponge
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoMemfd = errors.New("Memory file sponges require Linux.")
+
+func createMemfd(name string) (*os.File, error) {
+	return nil, errNoMemfd
+}
+
+func sealMemfd(f *os.File) error {
+	return errNoMemfd
+}
@@ -0,0 +1,219 @@
+package sponge
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// MemorySponge accumulates data in memory and then writes it directly
+// to the target, just like sponge(1).
+type MemorySponge struct {
+	TargetFn string
+	Data     []byte
+	Append   bool
+	Fsync    bool
+	Mode     ModeFunc
+	Metadata []MetadataFunc
+
+	SkipUnchanged bool
+	Unchanged     bool
+	Precondition  func() error
+	NoClobber     bool
+	CheckSpace    bool
+	FallbackFn    string
+	// opts are kept for saving the data in FallbackFn.
+	opts Options
+}
+
+// NewMemorySponge returns a sponge which writes directly to target.
+func NewMemorySponge(target string, opts Options) SpongeFile {
+	return &MemorySponge{
+		TargetFn: target,
+		Data:     make([]byte, 0, READSIZE),
+		Append:   opts.Append,
+		Fsync:    opts.Fsync,
+		Mode:     opts.Mode,
+		Metadata: opts.Metadata,
+
+		SkipUnchanged: opts.SkipUnchanged,
+		Precondition:  opts.Precondition,
+		NoClobber:     opts.NoClobber,
+		CheckSpace:    opts.CheckSpace,
+		FallbackFn:    opts.FallbackFn,
+		opts:          opts,
+	}
+}
+
+func (ms *MemorySponge) Begin(ctx context.Context) error {
+	return nil
+}
+
+func (ms *MemorySponge) Abort() error {
+	return nil
+}
+
+func (ms *MemorySponge) Write(d []byte) error {
+	ms.Data = append(ms.Data, d...)
+	return nil
+}
+
+func (ms *MemorySponge) Complete(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fi, err := os.Stat(ms.TargetFn)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	mode := DEFAULT_MODE
+	if err == nil {
+		mode = fi.Mode()
+	}
+	if ms.SkipUnchanged {
+		same, err := ms.sameAsTarget()
+		if err != nil {
+			return err
+		}
+		if same {
+			ms.Unchanged = true
+			return nil
+		}
+	}
+	if ms.Precondition != nil {
+		if err := ms.Precondition(); err != nil {
+			return err
+		}
+	}
+	if ms.CheckSpace {
+		if err := CheckSpace(filepath.Dir(ms.TargetFn), growth(ms.TargetFn, int64(len(ms.Data)), ms.Append)); err != nil {
+			return err
+		}
+	}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if ms.Append {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	if ms.NoClobber {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	}
+	if err := WriteFile(ms.TargetFn, ms.Data, flag, mode, ms.Fsync); err != nil {
+		if ms.NoClobber && os.IsExist(err) {
+			return &ModifiedError{Fn: ms.TargetFn, Detail: "already exists"}
+		}
+		return saveFallback(ctx, ms.TargetFn, ms.opts, bytes.NewReader(ms.Data), err)
+	}
+	if err := applyMetadata(ms.Metadata, ms.TargetFn, ms.TargetFn, fi); err != nil {
+		return err
+	}
+	if ms.Mode != nil {
+		return os.Chmod(ms.TargetFn, newMode(mode, ms.Mode))
+	}
+	return nil
+}
+
+// Appending changes the target unless there is nothing to append.
+func (ms *MemorySponge) sameAsTarget() (bool, error) {
+	if ms.Append {
+		return len(ms.Data) == 0, nil
+	}
+	return FileHasContents(ms.TargetFn, ms.Data)
+}
+
+func (ms *MemorySponge) Changed() bool {
+	return !ms.Unchanged
+}
+
+func (ms *MemorySponge) Cleanup() error {
+	return nil
+}
+
+func (ms *MemorySponge) Replay(w io.Writer) error {
+	return writeAll(w, ms.Data)
+}
+
+// WriteFile opens fn with flag, creating it with mode if necessary, and
+// writes data.  With fsync the data is flushed to storage before closing.
+func WriteFile(fn string, data []byte, flag int, mode os.FileMode, fsync bool) error {
+	f, err := os.OpenFile(fn, flag, mode)
+	if err != nil {
+		return err
+	}
+	n, err := f.Write(data)
+	if err == nil && n < len(data) {
+		err = io.ErrShortWrite
+	}
+	if err == nil && fsync {
+		err = f.Sync()
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// AtomicMemorySponge accumulates data in memory and then writes it
+// atomically using an AtomicSponge.
+type AtomicMemorySponge struct {
+	Writer SpongeFile
+	Data   []byte
+}
+
+// NewAtomicMemorySponge returns a memory sponge which replaces targetFn
+// atomically.
+func NewAtomicMemorySponge(targetFn string, opts Options) SpongeFile {
+	return &AtomicMemorySponge{
+		Writer: NewAtomicSponge(targetFn, opts),
+		Data:   make([]byte, 0, READSIZE),
+	}
+}
+
+func (ams *AtomicMemorySponge) Begin(ctx context.Context) error {
+	return nil
+}
+
+func (ams *AtomicMemorySponge) Write(d []byte) error {
+	ams.Data = append(ams.Data, d...)
+	return nil
+}
+
+func (ams *AtomicMemorySponge) Abort() error {
+	return ams.Writer.Abort()
+}
+
+func (ams *AtomicMemorySponge) Complete(ctx context.Context) error {
+	hintSize(ams.Writer, int64(len(ams.Data)))
+	if err := ams.Writer.Begin(ctx); err != nil {
+		return err
+	}
+	if err := ams.Writer.Write(ams.Data); err != nil {
+		return err
+	}
+	return ams.Writer.Complete(ctx)
+}
+
+func (ams *AtomicMemorySponge) Cleanup() error {
+	return ams.Writer.Cleanup()
+}
+
+func (ams *AtomicMemorySponge) Changed() bool {
+	return changed(ams.Writer)
+}
+
+func (ams *AtomicMemorySponge) ScratchFn() string {
+	return ScratchFn(ams.Writer)
+}
+
+func (ams *AtomicMemorySponge) Replay(w io.Writer) error {
+	return writeAll(w, ams.Data)
+}
+
+func writeAll(w io.Writer, data []byte) error {
+	n, err := w.Write(data)
+	if err == nil && n < len(data) {
+		return io.ErrShortWrite
+	}
+	return err
+}
@@ -0,0 +1,41 @@
+package sponge
+
+import (
+	"os"
+)
+
+// MetadataFunc gives fn, which is about to become targetFn, some of its
+// metadata.  target describes targetFn as it was before being written, and
+// is nil for new targets.  fn and targetFn are the same when the target is
+// written in place.
+type MetadataFunc func(fn, targetFn string, target os.FileInfo) error
+
+// Applies each of metadata to fn.
+func applyMetadata(metadata []MetadataFunc, fn, targetFn string, target os.FileInfo) error {
+	for _, m := range metadata {
+		if err := m(fn, targetFn, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Chown returns a MetadataFunc which gives the target uid and gid.  An id
+// of -1 keeps the target's current one, or the running user's for new
+// targets.
+func Chown(uid, gid int) MetadataFunc {
+	return func(fn, targetFn string, target os.FileInfo) error {
+		u, g := uid, gid
+		if target != nil {
+			if fu, fg, ok := FileOwner(target); ok {
+				if u == -1 {
+					u = fu
+				}
+				if g == -1 {
+					g = fg
+				}
+			}
+		}
+		return os.Chown(fn, u, g)
+	}
+}
@@ -0,0 +1,122 @@
+package sponge
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ModeFunc computes a target's new mode from its current one, which is
+// DEFAULT_MODE for new targets.
+type ModeFunc func(current os.FileMode) os.FileMode
+
+// The permission and special bits which modes may change.
+const modeBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+var octalModeRe = regexp.MustCompile(`^[0-7]{1,4}$`)
+var symbolicModeRe = regexp.MustCompile(`^([ugoa]*)((?:[-+=][rwxXst]*)+)$`)
+var modeOpRe = regexp.MustCompile(`[-+=][rwxXst]*`)
+
+// ParseMode parses an octal mode like 0640, or a chmod(1) style symbolic
+// mode like u=rw,g=r or g+w,o-rwx.  Symbolic modes without u, g, o, or a
+// apply to everyone; the umask is not consulted.
+func ParseMode(s string) (ModeFunc, error) {
+	if octalModeRe.MatchString(s) {
+		n, err := strconv.ParseUint(s, 8, 32)
+		if err != nil {
+			return nil, err
+		}
+		mode := os.FileMode(n & 0777)
+		if n&04000 != 0 {
+			mode |= os.ModeSetuid
+		}
+		if n&02000 != 0 {
+			mode |= os.ModeSetgid
+		}
+		if n&01000 != 0 {
+			mode |= os.ModeSticky
+		}
+		return func(current os.FileMode) os.FileMode {
+			return current&^modeBits | mode
+		}, nil
+	}
+	clauses := []func(os.FileMode) os.FileMode{}
+	for _, clause := range strings.Split(s, ",") {
+		m := symbolicModeRe.FindStringSubmatch(clause)
+		if m == nil {
+			return nil, fmt.Errorf("Invalid mode %q.", s)
+		}
+		who := whoMask(m[1])
+		for _, op := range modeOpRe.FindAllString(m[2], -1) {
+			clauses = append(clauses, modeClause(who, op[0], op[1:]))
+		}
+	}
+	return func(current os.FileMode) os.FileMode {
+		for _, clause := range clauses {
+			current = clause(current)
+		}
+		return current
+	}, nil
+}
+
+// The bits belonging to the classes of users named in who.
+func whoMask(who string) os.FileMode {
+	if who == "" || strings.Contains(who, "a") {
+		return modeBits
+	}
+	var mask os.FileMode
+	if strings.Contains(who, "u") {
+		mask |= 0700 | os.ModeSetuid
+	}
+	if strings.Contains(who, "g") {
+		mask |= 0070 | os.ModeSetgid
+	}
+	if strings.Contains(who, "o") {
+		mask |= 0007 | os.ModeSticky
+	}
+	return mask
+}
+
+// Applies a single operation like +rw to the bits in who.
+func modeClause(who os.FileMode, op byte, perms string) func(os.FileMode) os.FileMode {
+	return func(current os.FileMode) os.FileMode {
+		var bits os.FileMode
+		for _, p := range perms {
+			switch p {
+			case 'r':
+				bits |= 0444
+			case 'w':
+				bits |= 0222
+			case 'x':
+				bits |= 0111
+			case 'X':
+				if current.IsDir() || current&0111 != 0 {
+					bits |= 0111
+				}
+			case 's':
+				bits |= os.ModeSetuid | os.ModeSetgid
+			case 't':
+				bits |= os.ModeSticky
+			}
+		}
+		bits &= who
+		switch op {
+		case '+':
+			return current | bits
+		case '-':
+			return current &^ bits
+		default:
+			return current&^who | bits
+		}
+	}
+}
+
+// Returns the mode a target whose mode is current should be given.
+func newMode(current os.FileMode, mode ModeFunc) os.FileMode {
+	if mode == nil {
+		return current
+	}
+	return mode(current)
+}
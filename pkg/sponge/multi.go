@@ -0,0 +1,132 @@
+package sponge
+
+import (
+	"context"
+	"io"
+)
+
+// MultiSponge writes the same data to several sponges.  Each target is
+// replaced atomically if its sponge is atomic, but the group as a whole
+// is not: Complete commits the sponges in order and stops at the first
+// failure, aborting the rest.
+type MultiSponge struct {
+	Sponges []SpongeFile
+}
+
+// NewMultiSponge returns a sponge which fans out to sponges.
+func NewMultiSponge(sponges ...SpongeFile) SpongeFile {
+	return &MultiSponge{Sponges: sponges}
+}
+
+func (ms *MultiSponge) Begin(ctx context.Context) error {
+	for i, sf := range ms.Sponges {
+		if err := sf.Begin(ctx); err != nil {
+			abortAll(ms.Sponges[:i])
+			return err
+		}
+	}
+	return nil
+}
+
+func (ms *MultiSponge) Write(d []byte) error {
+	for _, sf := range ms.Sponges {
+		if err := sf.Write(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ms *MultiSponge) Abort() error {
+	return abortAll(ms.Sponges)
+}
+
+func (ms *MultiSponge) Complete(ctx context.Context) error {
+	for i, sf := range ms.Sponges {
+		if err := sf.Complete(ctx); err != nil {
+			abortAll(ms.Sponges[i+1:])
+			return err
+		}
+	}
+	return nil
+}
+
+func (ms *MultiSponge) Cleanup() error {
+	var err error
+	for _, sf := range ms.Sponges {
+		if err1 := sf.Cleanup(); err == nil {
+			err = err1
+		}
+	}
+	return err
+}
+
+// Replay replays the data from the first sponge.
+func (ms *MultiSponge) Replay(w io.Writer) error {
+	if len(ms.Sponges) == 0 {
+		return nil
+	}
+	return replay(ms.Sponges[0], w)
+}
+
+// Changed reports whether any of the sponges changed their target.
+func (ms *MultiSponge) Changed() bool {
+	for _, sf := range ms.Sponges {
+		if changed(sf) {
+			return true
+		}
+	}
+	return false
+}
+
+func abortAll(sponges []SpongeFile) error {
+	var err error
+	for _, sf := range sponges {
+		if err1 := sf.Abort(); err == nil {
+			err = err1
+		}
+	}
+	return err
+}
+
+// MultiBackup runs several backups together.
+type MultiBackup struct {
+	Backups []Backup
+}
+
+// NewMultiBackup returns a Backup which runs all of backups.
+func NewMultiBackup(backups ...Backup) Backup {
+	return &MultiBackup{Backups: backups}
+}
+
+func (mb *MultiBackup) Begin(ctx context.Context) error {
+	for i, b := range mb.Backups {
+		if err := b.Begin(ctx); err != nil {
+			for _, started := range mb.Backups[:i] {
+				started.Abort()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (mb *MultiBackup) Abort() error {
+	var err error
+	for _, b := range mb.Backups {
+		if err1 := b.Abort(); err == nil {
+			err = err1
+		}
+	}
+	return err
+}
+
+func (mb *MultiBackup) Complete() error {
+	var err error
+	for _, b := range mb.Backups {
+		if err1 := b.Complete(); err == nil {
+			err = err1
+		}
+	}
+	return err
+}
@@ -0,0 +1,55 @@
+package sponge
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CheckNoSymlinks fails if fn, or any directory on the way to it, is a
+// symlink, so that nobody able to write to those directories can redirect
+// a write elsewhere.  Parts of the path which don't exist yet pass.  The
+// check is best effort: fn is written by name afterwards, so a symlink
+// swapped in after the check is still followed.
+func CheckNoSymlinks(fn string) error {
+	if err := checkDirNoSymlinks(filepath.Dir(fn)); err != nil {
+		return err
+	}
+	fi, err := os.Lstat(fn)
+	if err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("Refusing %s, which is a symlink.", fn)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Checks each directory on the way to dir in turn.
+func walkNoSymlinks(dir string) error {
+	dir = filepath.Clean(dir)
+	prefix := filepath.VolumeName(dir)
+	rest := dir[len(prefix):]
+	if strings.HasPrefix(rest, string(filepath.Separator)) {
+		prefix += string(filepath.Separator)
+		rest = rest[1:]
+	}
+	if rest == "" || rest == "." {
+		return nil
+	}
+	for _, part := range strings.Split(rest, string(filepath.Separator)) {
+		prefix = filepath.Join(prefix, part)
+		fi, err := os.Lstat(prefix)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("Refusing %s, which is a symlink.", prefix)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package sponge
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// checkDirNoSymlinks opens dir with openat2(RESOLVE_NO_SYMLINKS), which
+// refuses symlinks anywhere in the path.  Otherwise, such as on kernels
+// without openat2 or when dir is missing, each directory is checked in
+// turn.  The directory is only checked, not kept open for writing into,
+// so this narrows the race with a symlink being swapped in rather than
+// closing it.
+func checkDirNoSymlinks(dir string) error {
+	how := &unix.OpenHow{
+		Flags:   unix.O_PATH | unix.O_DIRECTORY | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_NO_SYMLINKS,
+	}
+	fd, err := unix.Openat2(unix.AT_FDCWD, dir, how)
+	switch err {
+	case nil:
+		unix.Close(fd)
+		return nil
+	case unix.ELOOP:
+		return fmt.Errorf("Refusing %s, which passes through a symlink.", dir)
+	}
+	return walkNoSymlinks(dir)
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package sponge
+
+// checkDirNoSymlinks checks each directory on the way to dir in turn.
+func checkDirNoSymlinks(dir string) error {
+	return walkNoSymlinks(dir)
+}
@@ -0,0 +1,26 @@
+package sponge
+
+import (
+	"context"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// createFile moves src to dst, failing with a *ModifiedError if dst
+// exists, with renamex_np(RENAME_EXCL).  Filesystems without it fall
+// back to a hard link, which also refuses to replace dst.
+func createFile(ctx context.Context, src, dst string) error {
+	err := retryBusy(ctx, func() error {
+		return unix.RenamexNp(src, dst, unix.RENAME_EXCL)
+	})
+	switch err {
+	case nil:
+		return nil
+	case unix.EEXIST:
+		return &ModifiedError{Fn: dst, Detail: "already exists"}
+	case unix.EINVAL, unix.ENOTSUP:
+		return createByLink(src, dst)
+	}
+	return &os.LinkError{Op: "rename", Old: src, New: dst, Err: err}
+}
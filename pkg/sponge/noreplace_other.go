@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !windows
+
+package sponge
+
+import (
+	"context"
+)
+
+// createFile moves src to dst, failing with a *ModifiedError if dst
+// exists.
+func createFile(ctx context.Context, src, dst string) error {
+	return createByLink(src, dst)
+}
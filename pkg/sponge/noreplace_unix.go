@@ -0,0 +1,19 @@
+//go:build !windows
+
+package sponge
+
+import (
+	"os"
+)
+
+// createByLink moves src to dst by linking it there, which fails if dst
+// exists, and then removing src.
+func createByLink(src, dst string) error {
+	if err := os.Link(src, dst); err != nil {
+		if os.IsExist(err) {
+			return &ModifiedError{Fn: dst, Detail: "already exists"}
+		}
+		return err
+	}
+	return os.Remove(src)
+}
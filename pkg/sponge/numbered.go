@@ -0,0 +1,34 @@
+package sponge
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// NumberedBackupPattern returns a glob matching the numbered backups
+// made from backups matching pattern.
+func NumberedBackupPattern(pattern string) string {
+	return pattern + ".~*~"
+}
+
+// NextNumberedBackup returns the first unused numbered backup name for
+// backupFn in the style of GNU cp --backup=numbered: backupFn.~1~,
+// backupFn.~2~, and so on.  It picks one more than the highest number
+// already present.
+func NextNumberedBackup(backupFn string) (string, error) {
+	matches, err := filepath.Glob(NumberedBackupPattern(globQuote(backupFn)))
+	if err != nil {
+		return "", err
+	}
+	highest := 0
+	prefix := filepath.Clean(backupFn) + ".~"
+	for _, fn := range matches {
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(fn, prefix), "~"))
+		if err == nil && n > highest {
+			highest = n
+		}
+	}
+	return fmt.Sprintf("%s.~%d~", backupFn, highest+1), nil
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package sponge
+
+import (
+	"os"
+	"syscall"
+)
+
+// FileOwner returns the uid and gid owning fi.
+func FileOwner(fi os.FileInfo) (int, int, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
@@ -0,0 +1,10 @@
+package sponge
+
+import (
+	"os"
+)
+
+// FileOwner fails because Windows files have no uid or gid.
+func FileOwner(fi os.FileInfo) (int, int, bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,38 @@
+package sponge
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// MakeParents creates any missing directories above fn, like mkdir -p.
+// New directories get mode applied to 0777, regardless of the umask, or
+// with a nil mode 0777 less the umask.
+func MakeParents(fn string, mode ModeFunc) error {
+	dir := filepath.Dir(fn)
+	fi, err := os.Stat(dir)
+	if err == nil {
+		if !fi.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	if err := MakeParents(dir, mode); err != nil {
+		return err
+	}
+	if err := os.Mkdir(dir, 0777); err != nil {
+		// Someone else may have just made it.
+		if os.IsExist(err) {
+			return nil
+		}
+		return err
+	}
+	if mode != nil {
+		return os.Chmod(dir, newMode(0777, mode))
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package sponge
+
+// keptMetadata is the metadata which, like the mode, is always carried
+// over to a replaced target.  ACLs and SELinux contexts are permissions.
+func keptMetadata() []MetadataFunc {
+	return []MetadataFunc{CopyACLs(), CopySELinuxContext()}
+}
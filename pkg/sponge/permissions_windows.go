@@ -0,0 +1,90 @@
+package sponge
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// keptMetadata is the metadata which, like the mode, is always carried
+// over to a replaced target.
+func keptMetadata() []MetadataFunc {
+	return []MetadataFunc{CopySecurity(), CopyAttributes()}
+}
+
+// CopySecurity returns a MetadataFunc which copies the target's DACL,
+// and its owner and group where permitted.
+func CopySecurity() MetadataFunc {
+	return func(fn, targetFn string, target os.FileInfo) error {
+		if target == nil || fn == targetFn {
+			return nil
+		}
+		sd, err := windows.GetNamedSecurityInfo(targetFn, windows.SE_FILE_OBJECT,
+			windows.OWNER_SECURITY_INFORMATION|windows.GROUP_SECURITY_INFORMATION|windows.DACL_SECURITY_INFORMATION)
+		if err != nil {
+			return err
+		}
+		dacl, _, err := sd.DACL()
+		if err != nil {
+			return err
+		}
+		control, _, err := sd.Control()
+		if err != nil {
+			return err
+		}
+		info := windows.SECURITY_INFORMATION(windows.DACL_SECURITY_INFORMATION)
+		if control&windows.SE_DACL_PROTECTED != 0 {
+			info |= windows.PROTECTED_DACL_SECURITY_INFORMATION
+		} else {
+			info |= windows.UNPROTECTED_DACL_SECURITY_INFORMATION
+		}
+		if err := windows.SetNamedSecurityInfo(fn, windows.SE_FILE_OBJECT, info, nil, nil, dacl, nil); err != nil {
+			return err
+		}
+		// Giving files away requires privileges, so like keeping the
+		// mode this is best effort.
+		owner, _, err := sd.Owner()
+		if err != nil {
+			return nil
+		}
+		group, _, err := sd.Group()
+		if err != nil {
+			return nil
+		}
+		windows.SetNamedSecurityInfo(fn, windows.SE_FILE_OBJECT,
+			windows.OWNER_SECURITY_INFORMATION|windows.GROUP_SECURITY_INFORMATION, owner, group, nil, nil)
+		return nil
+	}
+}
+
+// KeptAttributes are the file attributes which CopyAttributes copies.
+const KeptAttributes = windows.FILE_ATTRIBUTE_READONLY | windows.FILE_ATTRIBUTE_HIDDEN |
+	windows.FILE_ATTRIBUTE_SYSTEM | windows.FILE_ATTRIBUTE_ARCHIVE |
+	windows.FILE_ATTRIBUTE_NOT_CONTENT_INDEXED
+
+// CopyAttributes returns a MetadataFunc which copies the target's
+// KeptAttributes, like hidden and readonly.
+func CopyAttributes() MetadataFunc {
+	return func(fn, targetFn string, target os.FileInfo) error {
+		if target == nil || fn == targetFn {
+			return nil
+		}
+		from, err := windows.UTF16PtrFromString(targetFn)
+		if err != nil {
+			return err
+		}
+		to, err := windows.UTF16PtrFromString(fn)
+		if err != nil {
+			return err
+		}
+		kept, err := windows.GetFileAttributes(from)
+		if err != nil {
+			return err
+		}
+		current, err := windows.GetFileAttributes(to)
+		if err != nil {
+			return err
+		}
+		return windows.SetFileAttributes(to, current&^KeptAttributes|kept&KeptAttributes)
+	}
+}
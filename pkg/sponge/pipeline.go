@@ -0,0 +1,60 @@
+package sponge
+
+import (
+	"context"
+	"io"
+)
+
+// PipelineDepth is how many READSIZE buffers TransferPipelined keeps in
+// flight.
+var PipelineDepth = 2
+
+// TransferPipelined is Transfer with reading and writing overlapped.  One
+// goroutine reads in while the caller's goroutine writes what it has
+// already read to sf, which helps when both are slow.
+func TransferPipelined(ctx context.Context, in io.Reader, sf SpongeFile) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	in, stop := InterruptibleReader(ctx, in)
+	defer stop()
+	free := make(chan []byte, PipelineDepth)
+	for i := 0; i < PipelineDepth; i++ {
+		free <- make([]byte, READSIZE)
+	}
+	// Holding every buffer, full never blocks the reader.
+	full := make(chan []byte, PipelineDepth)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(full)
+		for {
+			var buf []byte
+			select {
+			case buf = <-free:
+			case <-ctx.Done():
+				readErr <- ctx.Err()
+				return
+			}
+			n, err := in.Read(buf)
+			if n > 0 {
+				full <- buf[:n]
+			} else {
+				free <- buf
+			}
+			if err == io.EOF {
+				readErr <- nil
+				return
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+	for buf := range full {
+		if err := sf.Write(buf); err != nil {
+			return err
+		}
+		free <- buf[:cap(buf)]
+	}
+	return <-readErr
+}
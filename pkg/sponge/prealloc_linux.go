@@ -0,0 +1,22 @@
+package sponge
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// preallocate reserves size bytes of storage for f, extending it to at
+// least that size.  Filesystems which cannot preallocate are left
+// alone, but running out of space is an error.
+func preallocate(f *os.File, size int64) error {
+	err := unix.Fallocate(int(f.Fd()), 0, 0, size)
+	if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.ENOSYS) {
+		return nil
+	}
+	if err != nil {
+		return os.NewSyscallError("fallocate", err)
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package sponge
+
+import (
+	"os"
+)
+
+// preallocate does nothing, since only Linux has fallocate.
+func preallocate(f *os.File, size int64) error {
+	return nil
+}
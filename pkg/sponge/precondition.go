@@ -0,0 +1,84 @@
+package sponge
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ModifiedError reports that a target is not the version the caller
+// expected to replace, such as when it was changed by someone else after
+// it was sponged, so that committing would lose their change.
+type ModifiedError struct {
+	Fn string
+	// Detail says how the target differs, if not simply modified.
+	Detail string
+}
+
+func (e *ModifiedError) Error() string {
+	detail := e.Detail
+	if detail == "" {
+		detail = "was modified by someone else"
+	}
+	return fmt.Sprintf("%s %s, so it was left alone.", e.Fn, detail)
+}
+
+// Unmodified returns a precondition failing with a *ModifiedError unless
+// fn is still the same file, with the same size and modification time, as
+// it is now.  A missing fn must still be missing.
+func Unmodified(fn string) (func() error, error) {
+	before, err := os.Stat(fn)
+	if os.IsNotExist(err) {
+		before = nil
+	} else if err != nil {
+		return nil, err
+	}
+	return func() error {
+		after, err := os.Stat(fn)
+		if os.IsNotExist(err) {
+			after = nil
+		} else if err != nil {
+			return err
+		}
+		if !sameVersion(before, after) {
+			return &ModifiedError{Fn: fn}
+		}
+		return nil
+	}, nil
+}
+
+// Reports whether before and after are the same version of a file, or
+// are both missing.
+func sameVersion(before, after os.FileInfo) bool {
+	if before == nil || after == nil {
+		return before == after
+	}
+	return os.SameFile(before, after) && before.Size() == after.Size() && before.ModTime().Equal(after.ModTime())
+}
+
+// ExpectSHA256 returns a precondition failing with a *ModifiedError
+// unless fn exists and has the SHA-256 hex digest expected.
+func ExpectSHA256(fn, expected string) func() error {
+	expected = strings.ToLower(expected)
+	return func() error {
+		f, err := os.Open(fn)
+		if os.IsNotExist(err) {
+			return &ModifiedError{Fn: fn, Detail: "does not exist"}
+		}
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		if digest := hex.EncodeToString(h.Sum(nil)); digest != expected {
+			return &ModifiedError{Fn: fn, Detail: fmt.Sprintf("has sha256 %s, not %s", digest, expected)}
+		}
+		return nil
+	}
+}
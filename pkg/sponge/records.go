@@ -0,0 +1,89 @@
+package sponge
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// Records yields the records of a stream one at a time.
+type Records interface {
+	// Next returns a reader for the next record, or io.EOF when there
+	// are no more.  Each record must be read to its end before calling
+	// Next again.
+	Next() (io.Reader, error)
+}
+
+// RecordReader splits a stream into records, each ended by a delimiter
+// or by the end of the stream.  Empty records are skipped.
+type RecordReader struct {
+	br    *bufio.Reader
+	delim []byte
+}
+
+// NewRecordReader returns a reader for the records in r ended by delim.
+func NewRecordReader(r io.Reader, delim []byte) *RecordReader {
+	size := READSIZE
+	if size < len(delim) {
+		size = len(delim)
+	}
+	return &RecordReader{br: bufio.NewReaderSize(r, size), delim: delim}
+}
+
+// Next returns a reader for the next record, which ends at its
+// delimiter, or io.EOF when there are no more records.  Each record must
+// be read to its end before calling Next again.
+func (rr *RecordReader) Next() (io.Reader, error) {
+	for {
+		data, err := rr.br.Peek(len(rr.delim))
+		if bytes.Equal(data, rr.delim) {
+			rr.br.Discard(len(rr.delim))
+			continue
+		}
+		if len(data) == 0 {
+			return nil, err
+		}
+		return &record{rr: rr}, nil
+	}
+}
+
+// record reads one record from a RecordReader.
+type record struct {
+	rr   *RecordReader
+	done bool
+}
+
+func (rec *record) Read(p []byte) (int, error) {
+	if rec.done {
+		return 0, io.EOF
+	}
+	br, delim := rec.rr.br, rec.rr.delim
+	data, err := br.Peek(len(delim))
+	if err == io.EOF {
+		// The stream ends the record, and there is no delimiter left.
+		if len(data) == 0 {
+			rec.done = true
+			return 0, io.EOF
+		}
+		n := copy(p, data)
+		br.Discard(n)
+		return n, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	data, _ = br.Peek(br.Buffered())
+	if i := bytes.Index(data, delim); i == 0 {
+		br.Discard(len(delim))
+		rec.done = true
+		return 0, io.EOF
+	} else if i > 0 {
+		data = data[:i]
+	} else {
+		// The end might be the start of a delimiter.
+		data = data[:len(data)-len(delim)+1]
+	}
+	n := copy(p, data)
+	br.Discard(n)
+	return n, nil
+}
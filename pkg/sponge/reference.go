@@ -0,0 +1,30 @@
+package sponge
+
+import (
+	"os"
+)
+
+// Reference returns the mode and the other metadata needed to make a
+// target look like refFn: its owner, group, times, and extended
+// attributes.
+func Reference(refFn string) (ModeFunc, MetadataFunc, error) {
+	ref, err := os.Stat(refFn)
+	if err != nil {
+		return nil, nil, err
+	}
+	mode := func(current os.FileMode) os.FileMode {
+		return current&^modeBits | ref.Mode()&modeBits
+	}
+	metadata := func(fn, targetFn string, target os.FileInfo) error {
+		if uid, gid, ok := FileOwner(ref); ok {
+			if err := os.Chown(fn, uid, gid); err != nil {
+				return err
+			}
+		}
+		if err := copyXattrs(refFn, fn, nil); err != nil {
+			return err
+		}
+		return os.Chtimes(fn, fileAtime(ref), ref.ModTime())
+	}
+	return mode, metadata, nil
+}
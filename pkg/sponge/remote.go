@@ -0,0 +1,186 @@
+package sponge
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Uploader stores data at a remote destination.  Upload must either
+// store all of r or leave the destination as it was.
+type Uploader interface {
+	Upload(ctx context.Context, r io.ReadSeeker, size int64) error
+}
+
+// IsRemote reports whether target is a URL like s3://bucket/key naming a
+// remote destination, rather than a file.
+func IsRemote(target string) bool {
+	i := strings.Index(target, "://")
+	return i > 0 && !strings.ContainsAny(target[:i], `/\.`)
+}
+
+// NewUploader returns an Uploader for the remote destination target.
+// Uploaders writing temp files on the server name them with
+// opts.TempName.
+func NewUploader(target string, opts Options) (Uploader, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "s3":
+		up, err := NewS3Uploader(u)
+		if err != nil {
+			return nil, err
+		}
+		return up, nil
+	case "gs":
+		up, err := NewGCSUploader(u)
+		if err != nil {
+			return nil, err
+		}
+		return up, nil
+	case "azblob":
+		up, err := NewAzureUploader(u)
+		if err != nil {
+			return nil, err
+		}
+		return up, nil
+	case "sftp":
+		up, err := NewSFTPUploader(u, opts.TempName)
+		if err != nil {
+			return nil, err
+		}
+		return up, nil
+	case "sqlite":
+		up, err := NewSQLiteUploader(u)
+		if err != nil {
+			return nil, err
+		}
+		return up, nil
+	}
+	return nil, fmt.Errorf("Unsupported destination %q.", target)
+}
+
+// RemoteSponge accumulates data in a local tempfile, or in memory, and
+// then uploads it to a remote destination in one piece.
+type RemoteSponge struct {
+	TargetURL  string
+	Uploader   Uploader
+	TempDir    string
+	TempName   string
+	Memory     bool
+	LeaveDirty bool
+	Verify     func(ctx context.Context, fn string) error
+	SpongeFn   string
+	Sponge     *os.File
+	buf        bytes.Buffer
+}
+
+// NewRemoteSponge returns a sponge which uploads to target with up.  The
+// tempfile goes in opts.TempDir, or the system's temp directory.
+func NewRemoteSponge(target string, up Uploader, memory bool, opts Options) SpongeFile {
+	tempDir := opts.TempDir
+	if tempDir == "" {
+		tempDir = os.TempDir()
+	}
+	return &RemoteSponge{
+		TargetURL:  target,
+		Uploader:   up,
+		TempDir:    tempDir,
+		TempName:   opts.TempName,
+		Memory:     memory,
+		LeaveDirty: opts.LeaveDirty,
+		Verify:     opts.Verify,
+	}
+}
+
+func (rs *RemoteSponge) Begin(ctx context.Context) error {
+	if rs.Memory {
+		return nil
+	}
+	sponge, err := createTemp(rs.TempDir, rs.TempName)
+	if err != nil {
+		return err
+	}
+	rs.Sponge = sponge
+	rs.SpongeFn = sponge.Name()
+	return nil
+}
+
+func (rs *RemoteSponge) Abort() error {
+	return nil
+}
+
+func (rs *RemoteSponge) Write(d []byte) error {
+	if rs.Memory {
+		rs.buf.Write(d)
+		return nil
+	}
+	n, err := rs.Sponge.Write(d)
+	if err != nil {
+		return err
+	}
+	if n < len(d) {
+		return io.ErrShortWrite
+	}
+	return nil
+}
+
+func (rs *RemoteSponge) Complete(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if rs.Memory {
+		return rs.Uploader.Upload(ctx, bytes.NewReader(rs.buf.Bytes()), int64(rs.buf.Len()))
+	}
+	if rs.Verify != nil {
+		if err := rs.Verify(ctx, rs.SpongeFn); err != nil {
+			return err
+		}
+	}
+	size, err := rs.Sponge.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := rs.Sponge.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return rs.Uploader.Upload(ctx, rs.Sponge, size)
+}
+
+func (rs *RemoteSponge) ScratchFn() string {
+	return rs.SpongeFn
+}
+
+func (rs *RemoteSponge) Cleanup() error {
+	if rs.Sponge == nil {
+		return nil
+	}
+	err := rs.Sponge.Close()
+	rs.Sponge = nil
+	if rs.LeaveDirty {
+		return err
+	}
+	if rerr := removeFile(rs.SpongeFn); rerr != nil {
+		return rerr
+	}
+	return err
+}
+
+// Replay writes the uploaded data to w.
+func (rs *RemoteSponge) Replay(w io.Writer) error {
+	if rs.Memory {
+		_, err := w.Write(rs.buf.Bytes())
+		return err
+	}
+	if _, err := rs.Sponge.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.Copy(w, rs.Sponge)
+	return err
+}
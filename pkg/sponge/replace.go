@@ -0,0 +1,33 @@
+//go:build !windows
+
+package sponge
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+)
+
+// replaceFile atomically moves src over dst, retrying while dst is busy.
+func replaceFile(ctx context.Context, src, dst string) error {
+	return retryBusy(ctx, func() error {
+		return os.Rename(src, dst)
+	})
+}
+
+// removeFile removes fn.
+func removeFile(fn string) error {
+	return os.Remove(fn)
+}
+
+// readOnly reports whether err came from writing to a read-only
+// filesystem.
+func readOnly(err error) bool {
+	return errors.Is(err, syscall.EROFS)
+}
+
+// crossDevice reports whether err came from renaming across filesystems.
+func crossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
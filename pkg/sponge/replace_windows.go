@@ -0,0 +1,80 @@
+package sponge
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// replaceFile atomically moves src over dst with MoveFileEx, which
+// replaces an existing dst within a volume.
+func replaceFile(ctx context.Context, src, dst string) error {
+	from, err := windows.UTF16PtrFromString(src)
+	if err != nil {
+		return err
+	}
+	to, err := windows.UTF16PtrFromString(dst)
+	if err != nil {
+		return err
+	}
+	err = retryBusy(ctx, func() error {
+		return windows.MoveFileEx(from, to, windows.MOVEFILE_REPLACE_EXISTING|windows.MOVEFILE_WRITE_THROUGH)
+	})
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: src, New: dst, Err: err}
+	}
+	return nil
+}
+
+// createFile moves src to dst with MoveFileEx, failing with a
+// *ModifiedError if dst exists.
+func createFile(ctx context.Context, src, dst string) error {
+	from, err := windows.UTF16PtrFromString(src)
+	if err != nil {
+		return err
+	}
+	to, err := windows.UTF16PtrFromString(dst)
+	if err != nil {
+		return err
+	}
+	err = retryBusy(ctx, func() error {
+		return windows.MoveFileEx(from, to, windows.MOVEFILE_WRITE_THROUGH)
+	})
+	if errors.Is(err, windows.ERROR_ALREADY_EXISTS) || errors.Is(err, windows.ERROR_FILE_EXISTS) {
+		return &ModifiedError{Fn: dst, Detail: "already exists"}
+	}
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: src, New: dst, Err: err}
+	}
+	return nil
+}
+
+// removeFile removes fn, waiting for virus scanners and indexers which
+// briefly hold new files open.  Cleaning up goes on after cancellation,
+// so the wait does too.
+func removeFile(fn string) error {
+	return retryBusy(context.Background(), func() error {
+		return os.Remove(fn)
+	})
+}
+
+// busy reports whether err might go away by itself, as it does once
+// another process closes the file.
+func busy(err error) bool {
+	return errors.Is(err, windows.ERROR_SHARING_VIOLATION) ||
+		errors.Is(err, windows.ERROR_LOCK_VIOLATION) ||
+		errors.Is(err, windows.ERROR_ACCESS_DENIED)
+}
+
+// readOnly reports whether err came from writing to write-protected
+// media.
+func readOnly(err error) bool {
+	return errors.Is(err, windows.ERROR_WRITE_PROTECT)
+}
+
+// crossDevice reports whether err came from moving across volumes.
+func crossDevice(err error) bool {
+	return errors.Is(err, windows.ERROR_NOT_SAME_DEVICE)
+}
@@ -0,0 +1,94 @@
+package sponge
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// BackupPattern returns a glob matching every backup of targetFn which
+// the backup template could produce.  Placeholders which vary from run
+// to run become wildcards.
+func BackupPattern(template, targetFn string) string {
+	quoted := map[string]string{}
+	for ph, v := range staticPlaceholders(targetFn) {
+		quoted[ph] = globQuote(v)
+	}
+	parts := placeholderRe.Split(template, -1)
+	placeholders := placeholderRe.FindAllString(template, -1)
+	pattern := globQuote(parts[0])
+	for i, ph := range placeholders {
+		if q, ok := quoted[ph]; ok {
+			pattern += q
+		} else {
+			pattern += "*"
+		}
+		pattern += globQuote(parts[i+1])
+	}
+	return pattern
+}
+
+func globQuote(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// FindBackups returns the regular files matching pattern, newest first,
+// excluding targetFn itself.
+func FindBackups(pattern, targetFn string) ([]string, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	type backup struct {
+		fn string
+		fi os.FileInfo
+	}
+	backups := []backup{}
+	for _, fn := range matches {
+		if filepath.Clean(fn) == filepath.Clean(targetFn) {
+			continue
+		}
+		fi, err := os.Lstat(fn)
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		backups = append(backups, backup{fn, fi})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		ti, tj := backups[i].fi.ModTime(), backups[j].fi.ModTime()
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return backups[i].fn > backups[j].fn
+	})
+	fns := make([]string, len(backups))
+	for i, b := range backups {
+		fns[i] = b.fn
+	}
+	return fns, nil
+}
+
+// PruneBackups removes all but the newest keep regular files matching
+// pattern, never touching targetFn itself.
+func PruneBackups(pattern, targetFn string, keep int) error {
+	backups, err := FindBackups(pattern, targetFn)
+	if err != nil {
+		return err
+	}
+	for len(backups) > keep {
+		old := backups[len(backups)-1]
+		backups = backups[:len(backups)-1]
+		if err := os.Remove(old); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
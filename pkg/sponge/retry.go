@@ -0,0 +1,40 @@
+package sponge
+
+import (
+	"context"
+	"time"
+)
+
+// RenameRetries is how many times moving data into place is retried
+// while it fails transiently, such as while another process briefly
+// holds the file.  The delay between attempts doubles each time,
+// starting at RenameDelay, up to MaxRenameDelay.
+var RenameRetries = 6
+var RenameDelay = 10 * time.Millisecond
+var MaxRenameDelay = time.Second
+
+// MaxRenameRetries bounds RenameRetries, beyond which the wait is better
+// bounded by a timeout.
+const MaxRenameRetries = 100
+
+// Retries op while the file is busy, giving up with ctx.Err() when ctx is
+// done.
+func retryBusy(ctx context.Context, op func() error) error {
+	delay := RenameDelay
+	for i := 0; ; i++ {
+		err := op()
+		if err == nil || i >= RenameRetries || !busy(err) {
+			return err
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+		if delay *= 2; delay > MaxRenameDelay {
+			delay = MaxRenameDelay
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package sponge
+
+import (
+	"errors"
+	"syscall"
+)
+
+// busy reports whether err might go away by itself, such as when
+// the target is busy or is a running executable.
+func busy(err error) bool {
+	return errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.ETXTBSY)
+}
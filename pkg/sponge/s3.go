@@ -0,0 +1,46 @@
+package sponge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3Uploader uploads to an S3 object, in parts for large objects.  A
+// multipart upload only creates the object once every part has arrived,
+// and is aborted if any part fails.  Credentials come from the standard
+// AWS chain.
+type S3Uploader struct {
+	Bucket string
+	Key    string
+}
+
+// NewS3Uploader returns an uploader for a URL like s3://bucket/key.
+func NewS3Uploader(u *url.URL) (*S3Uploader, error) {
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" || strings.HasSuffix(key, "/") {
+		return nil, fmt.Errorf("Invalid S3 destination %q, expected s3://BUCKET/KEY.", u.String())
+	}
+	return &S3Uploader{Bucket: u.Host, Key: key}, nil
+}
+
+func (su *S3Uploader) Upload(ctx context.Context, r io.ReadSeeker, size int64) error {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return err
+	}
+	up := manager.NewUploader(s3.NewFromConfig(cfg))
+	_, err = up.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(su.Bucket),
+		Key:    aws.String(su.Key),
+		Body:   r,
+	})
+	return err
+}
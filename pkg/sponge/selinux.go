@@ -0,0 +1,10 @@
+package sponge
+
+// SELinuxXattr holds a file's SELinux security context.
+const SELinuxXattr = "security.selinux"
+
+// CopySELinuxContext returns a MetadataFunc which copies the target's
+// SELinux context, so services confined by policy can still use it.
+func CopySELinuxContext() MetadataFunc {
+	return CopyXattrs(SELinuxXattr)
+}
@@ -0,0 +1,200 @@
+package sponge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SFTPUploader uploads to a file on an SSH server.  It writes a temp file
+// beside the target and then renames it into place, so the target is
+// replaced atomically on servers supporting posix-rename.  Host keys are
+// checked against ~/.ssh/known_hosts, and it authenticates with the SSH
+// agent, the default keys in ~/.ssh, or a password in the URL.
+type SFTPUploader struct {
+	URL      *url.URL
+	Host     string
+	User     string
+	TargetFn string
+	// TempName is the template for the temp file's name.  See
+	// Options.TempName.
+	TempName string
+}
+
+// NewSFTPUploader returns an uploader for a URL like
+// sftp://user@host:port/path.  Paths beginning with /~/ are relative to
+// the user's login directory.  The temp file is named from tempName.
+func NewSFTPUploader(u *url.URL, tempName string) (*SFTPUploader, error) {
+	targetFn := u.Path
+	if strings.HasPrefix(targetFn, "/~/") {
+		targetFn = targetFn[3:]
+	}
+	if u.Hostname() == "" || targetFn == "" || strings.HasSuffix(targetFn, "/") {
+		return nil, fmt.Errorf("Invalid SFTP destination %q, expected sftp://HOST/PATH.", u.String())
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "22")
+	}
+	name := u.User.Username()
+	if name == "" {
+		if cu, err := user.Current(); err == nil {
+			name = cu.Username
+		}
+	}
+	return &SFTPUploader{URL: u, Host: host, User: name, TargetFn: targetFn, TempName: tempName}, nil
+}
+
+func (su *SFTPUploader) Upload(ctx context.Context, r io.ReadSeeker, size int64) error {
+	if err := su.upload(ctx, r); err != nil {
+		return fmt.Errorf("Cannot upload to %s: %w", su, err)
+	}
+	return nil
+}
+
+func (su *SFTPUploader) upload(ctx context.Context, r io.ReadSeeker) error {
+	conn, err := su.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// A hung server is cut off, leaving the temp file for it to clean up.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	f, tempFn, err := createSFTPTemp(client, path.Dir(su.TargetFn), su.TempName)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, ContextReader(ctx, r))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = su.replace(client, tempFn)
+	}
+	if err != nil {
+		client.Remove(tempFn)
+		return err
+	}
+	return nil
+}
+
+// sftpFS is the part of an *sftp.Client creating temp files.
+type sftpFS interface {
+	OpenFile(path string, f int) (*sftp.File, error)
+	Lstat(p string) (os.FileInfo, error)
+}
+
+// createSFTPTemp creates a new temp file in dir on the server, named by
+// template, like createTemp.  Servers speaking version 3 of the protocol
+// report a taken name as a plain failure, so a failed name is looked up
+// to tell.
+func createSFTPTemp(fs sftpFS, dir, template string) (*sftp.File, string, error) {
+	for i := 0; i < 10000; i++ {
+		name, err := tempName(template, strconv.FormatUint(rand.Uint64(), 36))
+		if err != nil {
+			return nil, "", err
+		}
+		fn := path.Join(dir, name)
+		f, err := fs.OpenFile(fn, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+		if err == nil {
+			return f, fn, nil
+		}
+		if _, serr := fs.Lstat(fn); serr != nil && !os.IsExist(err) {
+			return nil, "", err
+		}
+		template = retryTemplate(template)
+	}
+	return nil, "", errors.New("Cannot find an unused name for the tempfile.")
+}
+
+// Moves tempFn over the target, keeping the target's mode.
+func (su *SFTPUploader) replace(client *sftp.Client, tempFn string) error {
+	if fi, err := client.Stat(su.TargetFn); err == nil {
+		if err := client.Chmod(tempFn, fi.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+		return client.PosixRename(tempFn, su.TargetFn)
+	}
+	// Plain SFTP renames refuse to replace an existing file.
+	return client.Rename(tempFn, su.TargetFn)
+}
+
+// Connects and authenticates to the server.
+func (su *SFTPUploader) dial(ctx context.Context) (*ssh.Client, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot check host keys: %s", err)
+	}
+	auth := []ssh.AuthMethod{}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if ac, err := net.Dial("unix", sock); err == nil {
+			// The agent is only needed while authenticating.
+			defer ac.Close()
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(ac).Signers))
+		}
+	}
+	signers := []ssh.Signer{}
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		key, err := ioutil.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+		// Keys with passphrases are left to the agent.
+		if signer, err := ssh.ParsePrivateKey(key); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+	if password, ok := su.URL.User.Password(); ok {
+		auth = append(auth, ssh.Password(password))
+	}
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", su.Host)
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := ssh.NewClientConn(nc, su.Host, &ssh.ClientConfig{
+		User:            su.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+	})
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+func (su *SFTPUploader) String() string {
+	return su.URL.Redacted()
+}
@@ -0,0 +1,67 @@
+package sponge
+
+import (
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/pkg/sftp"
+)
+
+// takenFS is an SFTP server on which some names are already taken.
+// Like OpenSSH, it reports a taken name as a plain failure.
+type takenFS struct {
+	taken  map[string]bool
+	opened []string
+}
+
+func (fs *takenFS) OpenFile(fn string, f int) (*sftp.File, error) {
+	fs.opened = append(fs.opened, fn)
+	if fs.taken[fn] {
+		return nil, &sftp.StatusError{Code: uint32(sftp.ErrSSHFxFailure)}
+	}
+	fs.taken[fn] = true
+	return nil, nil
+}
+
+func (fs *takenFS) Lstat(fn string) (os.FileInfo, error) {
+	if fs.taken[fn] {
+		return nil, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+func TestCreateSFTPTempRetriesTakenNames(t *testing.T) {
+	pidName := "/srv/." + strconv.Itoa(os.Getpid()) + ".swp"
+	fs := &takenFS{taken: map[string]bool{pidName: true}}
+	_, fn, err := createSFTPTemp(fs, "/srv", ".{pid}.swp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fs.opened) != 2 || fs.opened[0] != pidName {
+		t.Fatalf("opened %q, want %s and then another name", fs.opened, pidName)
+	}
+	want := regexp.MustCompile(`^\.` + strconv.Itoa(os.Getpid()) + `[0-9a-z]+\.swp$`)
+	if path.Dir(fn) != "/srv" || !want.MatchString(path.Base(fn)) {
+		t.Fatalf("created %s, want {rand} added before .swp", fn)
+	}
+}
+
+func TestCreateSFTPTempFailsOnOtherErrors(t *testing.T) {
+	fs := &takenFS{taken: map[string]bool{}}
+	failing := &failingFS{fs}
+	if _, _, err := createSFTPTemp(failing, "/srv", ".{pid}.swp"); err != os.ErrPermission {
+		t.Fatalf("got %v, want %v", err, os.ErrPermission)
+	}
+}
+
+// failingFS refuses to create anything.
+type failingFS struct {
+	*takenFS
+}
+
+func (fs *failingFS) OpenFile(fn string, f int) (*sftp.File, error) {
+	return nil, os.ErrPermission
+}
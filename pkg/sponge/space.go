@@ -0,0 +1,33 @@
+package sponge
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// CheckSpace fails with an error wrapping syscall.ENOSPC unless the
+// filesystem holding dir has need bytes free.  Filesystems which can't
+// say how much is free are assumed to have room.
+func CheckSpace(dir string, need int64) error {
+	if need <= 0 {
+		return nil
+	}
+	free, err := freeSpace(dir)
+	if err != nil || free >= need {
+		return nil
+	}
+	return fmt.Errorf("Cannot write %d bytes in %s, which has only %d free: %w", need, dir, free, syscall.ENOSPC)
+}
+
+// growth returns how much more space targetFn needs to hold size bytes
+// in place of its current contents, or after them when appending.
+func growth(targetFn string, size int64, appending bool) int64 {
+	if appending {
+		return size
+	}
+	if fi, err := os.Stat(targetFn); err == nil && fi.Mode().IsRegular() {
+		return size - fi.Size()
+	}
+	return size
+}
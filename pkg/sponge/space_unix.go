@@ -0,0 +1,17 @@
+//go:build !windows
+
+package sponge
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// freeSpace returns how many bytes unprivileged users may still write
+// on the filesystem holding dir.
+func freeSpace(dir string) (int64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
@@ -0,0 +1,19 @@
+package sponge
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// freeSpace returns how many bytes the user may still write on the
+// volume holding dir, after any quota.
+func freeSpace(dir string) (int64, error) {
+	name, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var avail, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(name, &avail, &total, &free); err != nil {
+		return 0, err
+	}
+	return int64(avail), nil
+}
@@ -0,0 +1,96 @@
+package sponge
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+)
+
+// SparseBlock is the size of the all-zero blocks which sparse sponges
+// leave as holes.
+var SparseBlock = 4096
+
+var zeroBlock []byte
+
+// copyFile copies source to dest in chunks, so the kernel does the
+// copying with copy_file_range or sendfile where it can.  Holes in
+// source stay holes in dest.
+func copyFile(ctx context.Context, source, dest *os.File) (int64, error) {
+	size, err := source.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	for off := int64(0); off < size; {
+		start, end, err := nextData(source, off, size)
+		if err != nil {
+			return 0, err
+		}
+		if start >= size {
+			break
+		}
+		if _, err := source.Seek(start, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if _, err := dest.Seek(start, io.SeekStart); err != nil {
+			return 0, err
+		}
+		for start < end {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+			n := end - start
+			if n > CopyChunk {
+				n = CopyChunk
+			}
+			if _, err := io.CopyN(dest, source, n); err != nil {
+				return 0, err
+			}
+			start += n
+		}
+		off = end
+	}
+	// A trailing hole needs the size set explicitly.
+	if err := dest.Truncate(size); err != nil {
+		return 0, err
+	}
+	_, err = dest.Seek(size, io.SeekStart)
+	return size, err
+}
+
+// writeSparse writes d to f at offset off, skipping over whole blocks of
+// zeros instead of writing them.  It returns the offset after d.
+func writeSparse(f *os.File, d []byte, off int64) (int64, error) {
+	if zeroBlock == nil || len(zeroBlock) != SparseBlock {
+		zeroBlock = make([]byte, SparseBlock)
+	}
+	for len(d) > 0 {
+		n := SparseBlock - int(off%int64(SparseBlock))
+		if n > len(d) {
+			n = len(d)
+		}
+		if n == SparseBlock && bytes.Equal(d[:n], zeroBlock) {
+			if _, err := f.Seek(int64(n), io.SeekCurrent); err != nil {
+				return off, err
+			}
+		} else {
+			// Write everything up to the next block of zeros at once.
+			for n < len(d) {
+				m := SparseBlock
+				if m > len(d)-n {
+					m = len(d) - n
+				}
+				if m == SparseBlock && bytes.Equal(d[n:n+m], zeroBlock) {
+					break
+				}
+				n += m
+			}
+			if err := writeAll(f, d[:n]); err != nil {
+				return off, err
+			}
+		}
+		off += int64(n)
+		d = d[n:]
+	}
+	return off, nil
+}
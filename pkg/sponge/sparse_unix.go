@@ -0,0 +1,28 @@
+//go:build !windows
+
+package sponge
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// nextData finds the first region of data at or after off in f, which is
+// size bytes long.  Without SEEK_DATA support it is everything after off.
+func nextData(f *os.File, off, size int64) (int64, int64, error) {
+	start, err := f.Seek(off, unix.SEEK_DATA)
+	if errors.Is(err, syscall.ENXIO) {
+		return size, size, nil
+	}
+	if err != nil {
+		return off, size, nil
+	}
+	end, err := f.Seek(start, unix.SEEK_HOLE)
+	if err != nil {
+		return start, size, nil
+	}
+	return start, end, nil
+}
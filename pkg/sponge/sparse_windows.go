@@ -0,0 +1,11 @@
+package sponge
+
+import (
+	"os"
+)
+
+// nextData treats everything after off as data, since holes cannot be
+// found here.
+func nextData(f *os.File, off, size int64) (int64, int64, error) {
+	return off, size, nil
+}
@@ -0,0 +1,230 @@
+package sponge
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// READSIZE is the size of the buffer used when reading input.
+var READSIZE = 4096
+
+// MinBufferSize and MaxBufferSize bound the buffer size chosen by
+// BufferSize.
+var MinBufferSize = 64 << 10
+var MaxBufferSize = 1 << 20
+
+// DEFAULT_MODE is the mode given to targets which did not previously exist.
+var DEFAULT_MODE os.FileMode = 0600
+
+// Sponges accumulate data before moving them into the correct location on
+// the filesystem
+
+type SpongeFile interface {
+	// Begin prepares the sponge to receive data.
+	Begin(ctx context.Context) error
+	// Abort abandons the data written so far.
+	Abort() error
+	// Write accumulates data in the sponge.
+	Write([]byte) error
+	// Complete moves the accumulated data into place.
+	Complete(ctx context.Context) error
+	// Cleanup removes any scratch files.  Always call it when finished.
+	Cleanup() error
+}
+
+// Replayer is implemented by sponges which can write their accumulated
+// data to another destination after Complete.
+type Replayer interface {
+	Replay(w io.Writer) error
+}
+
+// Replays sf's data into w.
+func replay(sf SpongeFile, w io.Writer) error {
+	if r, ok := sf.(Replayer); ok {
+		return r.Replay(w)
+	}
+	return errors.New("Sponge cannot replay its data.")
+}
+
+// Scratcher is implemented by sponges which accumulate data in a
+// scratch file.  ScratchFn names it, or is "" if there is none yet.
+type Scratcher interface {
+	ScratchFn() string
+}
+
+// ScratchFn returns the name of sf's scratch file, or "" if it has none.
+func ScratchFn(sf SpongeFile) string {
+	if s, ok := sf.(Scratcher); ok {
+		return s.ScratchFn()
+	}
+	return ""
+}
+
+// Options control how a sponge writes its target.
+type Options struct {
+	// TempDir holds the scratch file.  It defaults to the target's
+	// directory, and expands {dir} and {base}.  On another filesystem
+	// than the target, the data is copied beside the target before it is
+	// renamed into place.
+	TempDir string
+	// TempName is a template for the scratch file's name, which may use
+	// {pid}, {rand}, and {time}.  It defaults to DefaultTempName.
+	TempName string
+	// LeaveDirty leaves the scratch file in place after Cleanup.
+	LeaveDirty bool
+	// Append adds the data to the end of the target instead of
+	// replacing it.
+	Append bool
+	// Fsync flushes the data to storage before moving it into place,
+	// and flushes the target's directory afterwards.
+	Fsync bool
+	// SkipUnchanged leaves the target untouched when it already holds
+	// exactly the accumulated data.
+	SkipUnchanged bool
+	// Verify, if set, is called with the name of the complete scratch
+	// file before it is moved into place.  An error prevents the commit.
+	Verify func(ctx context.Context, fn string) error
+	// Mode, if set, chooses the target's mode instead of keeping its
+	// current one.
+	Mode ModeFunc
+	// SizeHint, if positive, is the expected size of the data.  Scratch
+	// files reserve that much storage up front.
+	SizeHint int64
+	// Direct writes scratch files with direct I/O where the filesystem
+	// allows, so that large files do not evict the page cache.
+	Direct bool
+	// URing writes scratch files through io_uring where the kernel
+	// allows.  It is experimental.
+	URing bool
+	// Sparse leaves holes in the target instead of writing long runs of
+	// zeros.
+	Sparse bool
+	// Metadata is applied to the data before it becomes the target.
+	Metadata []MetadataFunc
+	// Precondition, if set, is called just before the data replaces the
+	// target.  An error prevents the commit.
+	Precondition func() error
+	// NoClobber only creates the target, failing with a *ModifiedError
+	// if it already exists, even if it appears at the last moment.
+	NoClobber bool
+	// ExchangeFn, if set, is where the target's old contents are kept,
+	// by atomically swapping them with the data where possible.
+	ExchangeFn string
+	// FallbackFn, if set, is where the data is saved instead when the
+	// target's filesystem turns out to be read-only.  Complete then
+	// fails with a *FallbackError.
+	FallbackFn string
+	// CheckSpace fails before writing into the target's filesystem, or
+	// reserving SizeHint, if there isn't room for the data.
+	CheckSpace bool
+	// Warn, if set, is told about problems which don't prevent the
+	// commit.
+	Warn func(msg string)
+}
+
+// Transfer reads from in until EOF, writing everything to sf.  Sponges
+// implementing io.ReaderFrom do the copying themselves, and are handed
+// files directly so that the kernel can copy them.  It stops with
+// ctx.Err() when ctx is done.
+func Transfer(ctx context.Context, in io.Reader, sf SpongeFile) error {
+	if f, ok := in.(*os.File); ok {
+		if rf, ok := sf.(io.ReaderFrom); ok && ctx.Done() != nil {
+			if err := transferFile(ctx, f, rf); err != errNotInterruptible {
+				return err
+			}
+		}
+	}
+	in, stop := InterruptibleReader(ctx, in)
+	defer stop()
+	var err error
+	if rf, ok := sf.(io.ReaderFrom); ok {
+		_, err = rf.ReadFrom(in)
+	} else {
+		_, err = copyBuffered(spongeWriter{sf}, in)
+	}
+	return err
+}
+
+var errNotInterruptible = errors.New("file cannot be interrupted")
+
+// transferFile lets rf copy f without hiding it behind a wrapper.  Pipes
+// and sockets supporting deadlines are woken by one, and regular files
+// never block, so they are copied CopyChunk bytes at a time with checks
+// for cancellation between.  Anything else returns errNotInterruptible
+// untouched.
+func transferFile(ctx context.Context, f *os.File, rf io.ReaderFrom) error {
+	if f.SetReadDeadline(time.Time{}) == nil {
+		stop := context.AfterFunc(ctx, func() {
+			f.SetReadDeadline(time.Now())
+		})
+		defer stop()
+		_, err := rf.ReadFrom(f)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return errNotInterruptible
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := rf.ReadFrom(&io.LimitedReader{R: f, N: CopyChunk})
+		if err != nil || n == 0 {
+			return err
+		}
+	}
+}
+
+// fileSource reports whether r reads straight from a file, possibly
+// through a limit, so that os.File.ReadFrom can let the kernel copy it.
+func fileSource(r io.Reader) bool {
+	if lr, ok := r.(*io.LimitedReader); ok {
+		r = lr.R
+	}
+	_, ok := r.(*os.File)
+	return ok
+}
+
+// copyBuffered copies r to w READSIZE bytes at a time.
+func copyBuffered(w io.Writer, r io.Reader) (int64, error) {
+	// Hiding r's WriteTo keeps io.CopyBuffer from choosing its own buffer.
+	return io.CopyBuffer(w, struct{ io.Reader }{r}, make([]byte, READSIZE))
+}
+
+// BufferSize picks a READSIZE for writing targetFn from its
+// filesystem's preferred I/O size.  New targets use their directory's.
+func BufferSize(targetFn string) int {
+	fi, err := os.Stat(targetFn)
+	if os.IsNotExist(err) {
+		fi, err = os.Stat(path.Dir(targetFn))
+	}
+	size := 0
+	if err == nil {
+		size = blockSize(fi)
+	}
+	if size < MinBufferSize {
+		return MinBufferSize
+	}
+	if size > MaxBufferSize {
+		return MaxBufferSize
+	}
+	return size
+}
+
+// TempDir expands the temp directory template for targetFn.
+func TempDir(tempDir, targetFn string) string {
+	if tempDir == "" {
+		return path.Dir(targetFn)
+	}
+	tempDir = strings.Replace(tempDir, "{dir}", path.Dir(targetFn), -1)
+	return strings.Replace(tempDir, "{base}", path.Base(targetFn), -1)
+}
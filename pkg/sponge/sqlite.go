@@ -0,0 +1,92 @@
+package sponge
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLiteUploader stores data as a blob in a row of an SQLite table.  The
+// row is updated, or inserted if there is none, in one transaction, so
+// readers see either the old blob or the new one.  The database and the
+// table must already exist.
+type SQLiteUploader struct {
+	DBFn      string
+	Table     string
+	KeyColumn string
+	Column    string
+	Key       string
+}
+
+// NewSQLiteUploader returns an uploader for a URL like
+// sqlite://db.path?table=t&key=k.  The key and blob columns are named
+// "key" and "value", unless keycolumn or column say otherwise.
+func NewSQLiteUploader(u *url.URL) (*SQLiteUploader, error) {
+	q := u.Query()
+	su := &SQLiteUploader{
+		DBFn:      u.Host + u.Path,
+		Table:     q.Get("table"),
+		KeyColumn: q.Get("keycolumn"),
+		Column:    q.Get("column"),
+		Key:       q.Get("key"),
+	}
+	if su.KeyColumn == "" {
+		su.KeyColumn = "key"
+	}
+	if su.Column == "" {
+		su.Column = "value"
+	}
+	if su.DBFn == "" || su.Table == "" || !q.Has("key") {
+		return nil, fmt.Errorf("Invalid SQLite destination %q, expected sqlite://DB?table=TABLE&key=KEY.", u.String())
+	}
+	return su, nil
+}
+
+func (su *SQLiteUploader) Upload(ctx context.Context, r io.ReadSeeker, size int64) error {
+	// SQLite binds blobs whole, so the data is read into memory.
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	// Refuse to create a missing database, and take the write lock when
+	// the transaction begins, waiting a while for other writers.
+	db, err := sql.Open("sqlite3", "file:"+su.DBFn+"?mode=rw&_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("Cannot open %s: %w", su.DBFn, err)
+	}
+	defer tx.Rollback()
+	table, keyCol, col := quoteIdent(su.Table), quoteIdent(su.KeyColumn), quoteIdent(su.Column)
+	res, err := tx.ExecContext(ctx, "UPDATE "+table+" SET "+col+" = ? WHERE "+keyCol+" = ?", data, su.Key)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO "+table+" ("+keyCol+", "+col+") VALUES (?, ?)", su.Key, data); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (su *SQLiteUploader) String() string {
+	return "sqlite://" + su.DBFn
+}
+
+// Quotes an SQL identifier.
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,21 @@
+package sponge
+
+import (
+	"context"
+	"io"
+)
+
+// StdoutTarget is the destination naming standard output.
+const StdoutTarget = "-"
+
+// WriterUploader copies the data to W, for destinations like stdout
+// which are a stream rather than storage.  Nothing is written until the
+// data is complete, but a failing writer may be left with part of it.
+type WriterUploader struct {
+	W io.Writer
+}
+
+func (wu WriterUploader) Upload(ctx context.Context, r io.ReadSeeker, size int64) error {
+	_, err := io.Copy(wu.W, ContextReader(ctx, r))
+	return err
+}
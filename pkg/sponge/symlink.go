@@ -0,0 +1,39 @@
+package sponge
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// MaxSymlinks is how many symlinks FollowSymlinks follows before giving
+// up on a loop.
+const MaxSymlinks = 40
+
+// FollowSymlinks returns the file which fn finally refers to, following
+// it while it is a symlink, so that replacing the result writes through
+// the links instead of replacing them.  A dangling link names the file
+// it would create.
+func FollowSymlinks(fn string) (string, error) {
+	for i := 0; i < MaxSymlinks; i++ {
+		fi, err := os.Lstat(fn)
+		if os.IsNotExist(err) {
+			return fn, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			return fn, nil
+		}
+		link, err := os.Readlink(fn)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(fn), link)
+		}
+		fn = link
+	}
+	return "", fmt.Errorf("Too many levels of symlinks in %s.", fn)
+}
@@ -0,0 +1,123 @@
+package sponge
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Rewrites a tar archive.  A replaced member keeps its header, apart from
+// its size and modification time, and its place in the archive.  New
+// members are added at the end.
+func rewriteTar(w io.Writer, old *os.File, member string, data io.ReadSeeker, size int64) error {
+	var r io.Reader
+	if old != nil {
+		r = old
+	}
+	return copyTar(w, r, member, data, size)
+}
+
+// Rewrites a gzipped tar archive.
+func rewriteTarGz(w io.Writer, old *os.File, member string, data io.ReadSeeker, size int64) error {
+	var r io.Reader
+	if old != nil {
+		zr, err := gzip.NewReader(old)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	zw := gzip.NewWriter(w)
+	if err := copyTar(zw, r, member, data, size); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func copyTar(w io.Writer, r io.Reader, member string, data io.ReadSeeker, size int64) error {
+	tw := tar.NewWriter(w)
+	written := false
+	if r != nil {
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			name := tarMemberName(hdr.Name)
+			if strings.HasPrefix(name, member+"/") {
+				return fmt.Errorf("%s is a directory in the archive.", member)
+			}
+			if name != member {
+				if err := tw.WriteHeader(hdr); err != nil {
+					return err
+				}
+				if _, err := io.Copy(tw, tr); err != nil {
+					return err
+				}
+				continue
+			}
+			if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+				return fmt.Errorf("%s is not a regular file in the archive.", member)
+			}
+			// Later copies of a member would override the new one.
+			if written {
+				continue
+			}
+			// Unchanged data keeps its timestamp, so that the archive is
+			// unchanged too.
+			same := false
+			if hdr.Size == size {
+				if same, err = SameContents(tr, data); err != nil {
+					return err
+				}
+			}
+			if !same {
+				hdr.ModTime = time.Now()
+			}
+			hdr.Size = size
+			if err := writeTarMember(tw, hdr, data, size); err != nil {
+				return err
+			}
+			written = true
+		}
+	}
+	if !written {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     member,
+			Mode:     int64(DEFAULT_MODE),
+			Size:     size,
+			ModTime:  time.Now(),
+		}
+		if err := writeTarMember(tw, hdr, data, size); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func writeTarMember(tw *tar.Writer, hdr *tar.Header, data io.ReadSeeker, size int64) error {
+	if _, err := data.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := io.CopyN(tw, data, size)
+	return err
+}
+
+// Normalizes names like ./etc/app.conf to etc/app.conf.
+func tarMemberName(name string) string {
+	return path.Clean(strings.TrimPrefix(name, "/"))
+}
@@ -0,0 +1,123 @@
+package sponge
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var placeholderRe = regexp.MustCompile(`\{[a-z]+\}`)
+
+// Placeholders which expand the same way on every run.
+func staticPlaceholders(targetFn string) map[string]string {
+	base := path.Base(targetFn)
+	ext := path.Ext(base)
+	return map[string]string{
+		"{dir}":  path.Dir(targetFn),
+		"{base}": base,
+		"{file}": targetFn,
+		"{name}": strings.TrimSuffix(base, ext),
+		"{ext}":  ext,
+	}
+}
+
+// BackupFile expands the backup filename template for targetFn.  The
+// placeholders are:
+//
+//	{file}  the target's full name
+//	{dir}   the target's directory
+//	{base}  the target's name within its directory
+//	{name}  the base without its extension
+//	{ext}   the extension, including the dot, or nothing
+//	{date}  the current date, as YYYYMMDD
+//	{time}  the current time, as HHMMSS
+//	{pid}   spunge's process ID
+//	{seq}   one more than the highest number in existing backups
+//
+// Unknown placeholders are an error.
+func BackupFile(template, targetFn string) (string, error) {
+	return ExpandBackupTemplate(template, targetFn, time.Now())
+}
+
+// ExpandBackupTemplate expands template like BackupFile using now as the
+// current time.
+func ExpandBackupTemplate(template, targetFn string, now time.Time) (string, error) {
+	values := staticPlaceholders(targetFn)
+	values["{date}"] = now.Format("20060102")
+	values["{time}"] = now.Format("150405")
+	values["{pid}"] = strconv.Itoa(os.Getpid())
+	// Literal pieces of the expansion; {seq} falls between them.
+	pieces := []string{""}
+	last := 0
+	for _, loc := range placeholderRe.FindAllStringIndex(template, -1) {
+		pieces[len(pieces)-1] += template[last:loc[0]]
+		last = loc[1]
+		ph := template[loc[0]:loc[1]]
+		if ph == "{seq}" {
+			pieces = append(pieces, "")
+			continue
+		}
+		v, ok := values[ph]
+		if !ok {
+			return "", fmt.Errorf("Unknown placeholder %s in %q.", ph, template)
+		}
+		pieces[len(pieces)-1] += v
+	}
+	pieces[len(pieces)-1] += template[last:]
+	if len(pieces) == 1 {
+		return pieces[0], nil
+	}
+	seq, err := nextSeq(pieces)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(pieces, strconv.Itoa(seq)), nil
+}
+
+// ExpandTemplate replaces each placeholder in template, such as
+// "{date}", with its value.  Placeholders without values are an error.
+func ExpandTemplate(template string, values map[string]string) (string, error) {
+	var err error
+	expanded := placeholderRe.ReplaceAllStringFunc(template, func(ph string) string {
+		v, ok := values[ph]
+		if !ok && err == nil {
+			err = fmt.Errorf("Unknown placeholder %s in %q.", ph, template)
+		}
+		return v
+	})
+	return expanded, err
+}
+
+// Finds one more than the highest sequence number in existing files
+// named by pieces joined with numbers.
+func nextSeq(pieces []string) (int, error) {
+	// Glob returns clean paths, so clean the pieces to match.
+	pieces = strings.Split(filepath.Clean(strings.Join(pieces, "\x00")), "\x00")
+	globs := make([]string, len(pieces))
+	res := make([]string, len(pieces))
+	for i, p := range pieces {
+		globs[i] = globQuote(p)
+		res[i] = regexp.QuoteMeta(p)
+	}
+	matches, err := filepath.Glob(strings.Join(globs, "*"))
+	if err != nil {
+		return 0, err
+	}
+	re := regexp.MustCompile("^" + res[0] + `(\d+)` + strings.Join(res[1:], `\d+`) + "$")
+	highest := 0
+	for _, fn := range matches {
+		m := re.FindStringSubmatch(fn)
+		if m == nil {
+			continue
+		}
+		if n, err := strconv.Atoi(m[1]); err == nil && n > highest {
+			highest = n
+		}
+	}
+	return highest + 1, nil
+}
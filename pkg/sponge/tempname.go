@@ -0,0 +1,82 @@
+package sponge
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTempName is the template for scratch file names when
+// Options.TempName is empty.
+const DefaultTempName = ".sponge{rand}"
+
+// CheckTempName checks a template for scratch file names.  It may use
+// {pid}, {rand}, and {time}, and must expand to a plain filename.
+func CheckTempName(template string) error {
+	_, err := tempName(template, "0")
+	return err
+}
+
+// tempName expands template, with rnd for {rand}.  Templates using no
+// placeholders get {rand}, so that names don't collide.
+func tempName(template, rnd string) (string, error) {
+	if template == "" {
+		template = DefaultTempName
+	}
+	if !strings.Contains(template, "{rand}") && !strings.Contains(template, "{pid}") && !strings.Contains(template, "{time}") {
+		template = withRand(template)
+	}
+	name, err := ExpandTemplate(template, map[string]string{
+		"{pid}":  strconv.Itoa(os.Getpid()),
+		"{rand}": rnd,
+		"{time}": time.Now().Format("20060102150405"),
+	})
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", fmt.Errorf("Invalid temp file name %q, which must be a plain filename.", template)
+	}
+	return name, nil
+}
+
+// withRand adds {rand} to template before its extension, if it has one.
+func withRand(template string) string {
+	ext := filepath.Ext(template)
+	if ext == template {
+		return template + "{rand}"
+	}
+	return strings.TrimSuffix(template, ext) + "{rand}" + ext
+}
+
+// retryTemplate returns the template to use once a name from template
+// was taken, such as when one process writes several targets in a
+// directory with a template using only {pid}.
+func retryTemplate(template string) string {
+	if template != "" && !strings.Contains(template, "{rand}") {
+		return withRand(template)
+	}
+	return template
+}
+
+// createTemp creates a new scratch file in dir, named by template.
+func createTemp(dir, template string) (*os.File, error) {
+	for i := 0; i < 10000; i++ {
+		name, err := tempName(template, strconv.FormatUint(uint64(rand.Uint32()), 10))
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			template = retryTemplate(template)
+			continue
+		}
+		return f, err
+	}
+	return nil, errors.New("Cannot find an unused name for the tempfile.")
+}
@@ -0,0 +1,45 @@
+package sponge
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+type throttledReader struct {
+	ctx   context.Context
+	r     io.Reader
+	rate  int64
+	start time.Time
+	total int64
+}
+
+// ThrottledReader returns a reader which reads from r at no more than
+// rate bytes per second on average.  Waits end early with ctx.Err() when
+// ctx is done.
+func ThrottledReader(ctx context.Context, r io.Reader, rate int64) io.Reader {
+	return &throttledReader{ctx: ctx, r: r, rate: rate}
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	if tr.start.IsZero() {
+		tr.start = time.Now()
+	}
+	// Reading a tenth of a second's worth at a time keeps it smooth.
+	if max := tr.rate / 10; max > 0 && int64(len(p)) > max {
+		p = p[:max]
+	}
+	n, err := tr.r.Read(p)
+	tr.total += int64(n)
+	due := tr.start.Add(time.Duration(float64(tr.total) / float64(tr.rate) * float64(time.Second)))
+	if wait := time.Until(due); wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-tr.ctx.Done():
+			return n, tr.ctx.Err()
+		}
+	}
+	return n, err
+}
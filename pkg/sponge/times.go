@@ -0,0 +1,16 @@
+package sponge
+
+import (
+	"os"
+)
+
+// PreserveTimes returns a MetadataFunc which gives the target back its
+// previous access and modification times.
+func PreserveTimes() MetadataFunc {
+	return func(fn, targetFn string, target os.FileInfo) error {
+		if target == nil {
+			return nil
+		}
+		return os.Chtimes(fn, fileAtime(target), target.ModTime())
+	}
+}
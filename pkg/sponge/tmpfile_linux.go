@@ -0,0 +1,48 @@
+package sponge
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// openTmpFile creates an unnamed file in dir with O_TMPFILE.  Its name
+// is a /proc path which other processes can open while it is open.
+func openTmpFile(dir string) (*os.File, error) {
+	fd, err := unix.Open(dir, unix.O_TMPFILE|unix.O_RDWR|unix.O_CLOEXEC, uint32(DEFAULT_MODE))
+	if err != nil {
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("/proc/%d/fd/%d", os.Getpid(), fd))
+	// Linking it into place later needs /proc.
+	if _, err := os.Stat(f.Name()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// linkTmpFile gives the unnamed file f a name in dir from template.
+func linkTmpFile(f *os.File, dir, template string) (string, error) {
+	for i := 0; i < 10000; i++ {
+		name, err := tempName(template, strconv.FormatUint(uint64(rand.Uint32()), 10))
+		if err != nil {
+			return "", err
+		}
+		fn := filepath.Join(dir, name)
+		err = unix.Linkat(unix.AT_FDCWD, f.Name(), unix.AT_FDCWD, fn, unix.AT_SYMLINK_FOLLOW)
+		if err == nil {
+			return fn, nil
+		}
+		if err != unix.EEXIST {
+			return "", &os.LinkError{Op: "link", Old: f.Name(), New: fn, Err: err}
+		}
+		template = retryTemplate(template)
+	}
+	return "", errors.New("Cannot find an unused name for the tempfile.")
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package sponge
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoTmpFile = errors.New("Unnamed tempfiles are not supported.")
+
+// openTmpFile fails, because only Linux has O_TMPFILE.
+func openTmpFile(dir string) (*os.File, error) {
+	return nil, errNoTmpFile
+}
+
+func linkTmpFile(f *os.File, dir, template string) (string, error) {
+	return "", errNoTmpFile
+}
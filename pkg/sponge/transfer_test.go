@@ -0,0 +1,125 @@
+package sponge
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readerFromSponge records what Transfer hands to ReadFrom.
+type readerFromSponge struct {
+	buf     bytes.Buffer
+	sources []io.Reader
+}
+
+func (s *readerFromSponge) Begin(ctx context.Context) error    { return nil }
+func (s *readerFromSponge) Abort() error                       { return nil }
+func (s *readerFromSponge) Write(d []byte) error               { return writeAll(&s.buf, d) }
+func (s *readerFromSponge) Complete(ctx context.Context) error { return nil }
+func (s *readerFromSponge) Cleanup() error                     { return nil }
+
+func (s *readerFromSponge) ReadFrom(r io.Reader) (int64, error) {
+	s.sources = append(s.sources, r)
+	return s.buf.ReadFrom(r)
+}
+
+func TestTransferHandsFilesToReadFrom(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "input")
+	data := bytes.Repeat([]byte("spunge"), 1000)
+	if err := os.WriteFile(fn, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	defer func(chunk int64) { CopyChunk = chunk }(CopyChunk)
+	CopyChunk = 1024
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &readerFromSponge{}
+	if err := Transfer(ctx, f, s); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s.buf.Bytes(), data) {
+		t.Fatalf("copied %d bytes, want %d", s.buf.Len(), len(data))
+	}
+	if len(s.sources) == 0 {
+		t.Fatal("ReadFrom was never called")
+	}
+	for _, r := range s.sources {
+		if !fileSource(r) {
+			t.Fatalf("ReadFrom got %T, which hides the file from the kernel", r)
+		}
+	}
+}
+
+func TestTransferCopiesFilesIntoAtomicSponge(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "input")
+	data := bytes.Repeat([]byte("spunge"), 1000)
+	if err := os.WriteFile(in, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := filepath.Join(dir, "output")
+	s := NewAtomicSponge(out, Options{})
+	defer s.Cleanup()
+	if err := s.Begin(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := Transfer(ctx, f, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Complete(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("wrote %d bytes, want %d", len(got), len(data))
+	}
+}
+
+func TestTransferInterruptsPipes(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	s := &readerFromSponge{}
+	done := make(chan error, 1)
+	go func() { done <- Transfer(ctx, r, s) }()
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Transfer ignored the context")
+	}
+	for _, src := range s.sources {
+		if _, ok := src.(*os.File); !ok {
+			t.Fatalf("ReadFrom got %T, which hides the pipe from the kernel", src)
+		}
+	}
+}
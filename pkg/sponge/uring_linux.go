@@ -0,0 +1,298 @@
+package sponge
+
+import (
+	"io"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// URingDepth is how many writes a uring sponge keeps in flight, and
+// URingBufferSize is the size of each.
+var URingDepth = 8
+var URingBufferSize = 256 << 10
+
+// From linux/io_uring.h.  Writev is used rather than write because it
+// is supported by every kernel with io_uring.
+const (
+	uringOpWritev       = 2
+	uringEnterGetEvents = 1
+	uringOffSQRing      = 0
+	uringOffCQRing      = 0x8000000
+	uringOffSQEs        = 0x10000000
+)
+
+type uringSQRingOffsets struct {
+	Head, Tail, RingMask, RingEntries, Flags, Dropped, Array, Resv1 uint32
+	UserAddr                                                        uint64
+}
+
+type uringCQRingOffsets struct {
+	Head, Tail, RingMask, RingEntries, Overflow, CQEs, Flags, Resv1 uint32
+	UserAddr                                                        uint64
+}
+
+type uringParams struct {
+	SQEntries, CQEntries, Flags, SQThreadCPU, SQThreadIdle, Features, WQFd uint32
+	Resv                                                                   [3]uint32
+	SQOff                                                                  uringSQRingOffsets
+	CQOff                                                                  uringCQRingOffsets
+}
+
+type uringSQE struct {
+	Opcode      uint8
+	Flags       uint8
+	IOPrio      uint16
+	Fd          int32
+	Off         uint64
+	Addr        uint64
+	Len         uint32
+	RWFlags     uint32
+	UserData    uint64
+	BufIndex    uint16
+	Personality uint16
+	SpliceFdIn  int32
+	Addr3       uint64
+	Pad         uint64
+}
+
+type uringCQE struct {
+	UserData uint64
+	Res      int32
+	Flags    uint32
+}
+
+// uring is a minimal io_uring instance with one submitter.
+type uring struct {
+	fd      int
+	mmaps   [][]byte
+	sqTail  *uint32
+	sqMask  uint32
+	sqArray []uint32
+	sqes    []uringSQE
+	cqHead  *uint32
+	cqTail  *uint32
+	cqMask  uint32
+	cqes    []uringCQE
+}
+
+func newURing(entries uint32) (*uring, error) {
+	var p uringParams
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uintptr(entries), uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		return nil, os.NewSyscallError("io_uring_setup", errno)
+	}
+	r := &uring{fd: int(fd)}
+	sqRing, err := r.mmap(uringOffSQRing, int(p.SQOff.Array+p.SQEntries*4))
+	if err != nil {
+		return nil, err
+	}
+	cqRing, err := r.mmap(uringOffCQRing, int(p.CQOff.CQEs)+int(p.CQEntries)*int(unsafe.Sizeof(uringCQE{})))
+	if err != nil {
+		return nil, err
+	}
+	sqes, err := r.mmap(uringOffSQEs, int(p.SQEntries)*int(unsafe.Sizeof(uringSQE{})))
+	if err != nil {
+		return nil, err
+	}
+	r.sqTail = (*uint32)(unsafe.Pointer(&sqRing[p.SQOff.Tail]))
+	r.sqMask = *(*uint32)(unsafe.Pointer(&sqRing[p.SQOff.RingMask]))
+	r.sqArray = unsafe.Slice((*uint32)(unsafe.Pointer(&sqRing[p.SQOff.Array])), p.SQEntries)
+	r.sqes = unsafe.Slice((*uringSQE)(unsafe.Pointer(&sqes[0])), p.SQEntries)
+	r.cqHead = (*uint32)(unsafe.Pointer(&cqRing[p.CQOff.Head]))
+	r.cqTail = (*uint32)(unsafe.Pointer(&cqRing[p.CQOff.Tail]))
+	r.cqMask = *(*uint32)(unsafe.Pointer(&cqRing[p.CQOff.RingMask]))
+	r.cqes = unsafe.Slice((*uringCQE)(unsafe.Pointer(&cqRing[p.CQOff.CQEs])), p.CQEntries)
+	return r, nil
+}
+
+// Maps part of the ring into memory, closing the ring on failure.
+func (r *uring) mmap(offset int64, size int) ([]byte, error) {
+	b, err := unix.Mmap(r.fd, offset, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		r.Close()
+		return nil, os.NewSyscallError("mmap", err)
+	}
+	r.mmaps = append(r.mmaps, b)
+	return b, nil
+}
+
+// submit queues sqe and tells the kernel about it.
+func (r *uring) submit(sqe uringSQE) error {
+	tail := *r.sqTail
+	idx := tail & r.sqMask
+	r.sqes[idx] = sqe
+	r.sqArray[idx] = idx
+	atomic.StoreUint32(r.sqTail, tail+1)
+	return r.enter(1, 0, 0)
+}
+
+// wait returns the next completion, blocking until there is one.
+func (r *uring) wait() (uringCQE, error) {
+	for {
+		head := *r.cqHead
+		if head != atomic.LoadUint32(r.cqTail) {
+			cqe := r.cqes[head&r.cqMask]
+			atomic.StoreUint32(r.cqHead, head+1)
+			return cqe, nil
+		}
+		if err := r.enter(0, 1, uringEnterGetEvents); err != nil {
+			return uringCQE{}, err
+		}
+	}
+}
+
+func (r *uring) enter(toSubmit, minComplete, flags uint32) error {
+	for {
+		_, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(r.fd),
+			uintptr(toSubmit), uintptr(minComplete), uintptr(flags), 0, 0)
+		if errno == unix.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return os.NewSyscallError("io_uring_enter", errno)
+		}
+		return nil
+	}
+}
+
+func (r *uring) Close() error {
+	for _, b := range r.mmaps {
+		unix.Munmap(b)
+	}
+	r.mmaps = nil
+	if r.fd < 0 {
+		return nil
+	}
+	err := unix.Close(r.fd)
+	r.fd = -1
+	return err
+}
+
+// uringWriter writes a file through io_uring, keeping several buffers'
+// worth of writes in flight so the caller rarely waits for the disk.
+type uringWriter struct {
+	ring     *uring
+	f        *os.File
+	bufs     [][]byte
+	iovecs   []unix.Iovec
+	offsets  []int64
+	free     []int
+	cur      int
+	n        int
+	offset   int64
+	inflight int
+	err      error
+}
+
+// newURingWriter writes to f starting at offset.  It fails on kernels
+// without io_uring, or where seccomp forbids it.
+func newURingWriter(f *os.File, offset int64) (flushWriter, error) {
+	ring, err := newURing(uint32(URingDepth))
+	if err != nil {
+		return nil, err
+	}
+	uw := &uringWriter{
+		ring:    ring,
+		f:       f,
+		bufs:    make([][]byte, URingDepth),
+		iovecs:  make([]unix.Iovec, URingDepth),
+		offsets: make([]int64, URingDepth),
+		cur:     -1,
+		offset:  offset,
+	}
+	for i := range uw.bufs {
+		uw.bufs[i] = make([]byte, URingBufferSize)
+		uw.free = append(uw.free, i)
+	}
+	return uw, nil
+}
+
+func (uw *uringWriter) Write(d []byte) (int, error) {
+	written := 0
+	for len(d) > 0 && uw.err == nil {
+		if uw.cur < 0 {
+			for len(uw.free) == 0 && uw.err == nil {
+				uw.err = uw.reap()
+			}
+			if uw.err != nil {
+				break
+			}
+			uw.cur = uw.free[len(uw.free)-1]
+			uw.free = uw.free[:len(uw.free)-1]
+			uw.n = 0
+		}
+		n := copy(uw.bufs[uw.cur][uw.n:], d)
+		uw.n += n
+		written += n
+		d = d[n:]
+		if uw.n == len(uw.bufs[uw.cur]) {
+			uw.err = uw.submit()
+		}
+	}
+	return written, uw.err
+}
+
+// Submits the buffer being filled.
+func (uw *uringWriter) submit() error {
+	slot := uw.cur
+	uw.cur = -1
+	uw.iovecs[slot].Base = &uw.bufs[slot][0]
+	uw.iovecs[slot].SetLen(uw.n)
+	uw.offsets[slot] = uw.offset
+	uw.offset += int64(uw.n)
+	uw.inflight++
+	return uw.ring.submit(uringSQE{
+		Opcode:   uringOpWritev,
+		Fd:       int32(uw.f.Fd()),
+		Off:      uint64(uw.offsets[slot]),
+		Addr:     uint64(uintptr(unsafe.Pointer(&uw.iovecs[slot]))),
+		Len:      1,
+		UserData: uint64(slot),
+	})
+}
+
+// Waits for a write to finish and frees its buffer.  Short writes are
+// finished synchronously.
+func (uw *uringWriter) reap() error {
+	cqe, err := uw.ring.wait()
+	if err != nil {
+		return err
+	}
+	uw.inflight--
+	slot := int(cqe.UserData)
+	uw.free = append(uw.free, slot)
+	if cqe.Res < 0 {
+		return &os.PathError{Op: "write", Path: uw.f.Name(), Err: syscall.Errno(-cqe.Res)}
+	}
+	want := int(uw.iovecs[slot].Len)
+	if int(cqe.Res) < want {
+		_, err := uw.f.WriteAt(uw.bufs[slot][cqe.Res:want], uw.offsets[slot]+int64(cqe.Res))
+		return err
+	}
+	return nil
+}
+
+// Flush waits for every write to finish, closes the ring, and leaves f
+// positioned after the data.
+func (uw *uringWriter) Flush() error {
+	if uw.ring.fd < 0 {
+		return uw.err
+	}
+	if uw.err == nil && uw.cur >= 0 && uw.n > 0 {
+		uw.err = uw.submit()
+	}
+	for uw.err == nil && uw.inflight > 0 {
+		uw.err = uw.reap()
+	}
+	// Closing the ring waits for anything still in flight.
+	uw.ring.Close()
+	if uw.err != nil {
+		return uw.err
+	}
+	_, err := uw.f.Seek(uw.offset, io.SeekStart)
+	return err
+}
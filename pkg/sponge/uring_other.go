@@ -0,0 +1,13 @@
+//go:build !linux
+
+package sponge
+
+import (
+	"errors"
+	"os"
+)
+
+// newURingWriter fails, because only Linux has io_uring.
+func newURingWriter(f *os.File, offset int64) (flushWriter, error) {
+	return nil, errors.New("Cannot use io_uring on this platform.")
+}
@@ -0,0 +1,87 @@
+package sponge
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrClosed is returned when using a Writer after Close or Abort.
+var ErrClosed = errors.New("Sponge writer is already closed.")
+
+// Writer adapts a SpongeFile to io.WriteCloser.  Close completes the
+// sponge, and Abort abandons it.  Both clean up scratch files.
+//
+// If any Write fails then Close aborts instead, so partial data is never
+// moved into place.
+type Writer struct {
+	ctx    context.Context
+	sf     SpongeFile
+	err    error
+	closed bool
+}
+
+// NewWriter begins sf and returns a Writer for it.  Once ctx is done
+// writes fail and Close aborts.
+func NewWriter(ctx context.Context, sf SpongeFile) (*Writer, error) {
+	if err := sf.Begin(ctx); err != nil {
+		sf.Cleanup()
+		return nil, err
+	}
+	return &Writer{ctx: ctx, sf: sf}, nil
+}
+
+// Create returns a Writer which atomically replaces target when closed.
+func Create(ctx context.Context, target string, opts Options) (*Writer, error) {
+	return NewWriter(ctx, NewAtomicSponge(target, opts))
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, ErrClosed
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	if err := w.ctx.Err(); err != nil {
+		w.err = err
+		return 0, err
+	}
+	if err := w.sf.Write(p); err != nil {
+		w.err = err
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close moves the accumulated data into place.
+func (w *Writer) Close() error {
+	if w.closed {
+		return ErrClosed
+	}
+	if w.err != nil {
+		w.Abort()
+		return w.err
+	}
+	w.closed = true
+	err := w.sf.Complete(w.ctx)
+	if err != nil {
+		w.sf.Abort()
+	}
+	if err1 := w.sf.Cleanup(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// Abort abandons the accumulated data, leaving the target untouched.
+func (w *Writer) Abort() error {
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+	err := w.sf.Abort()
+	if err1 := w.sf.Cleanup(); err == nil {
+		err = err1
+	}
+	return err
+}
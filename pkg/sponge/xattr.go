@@ -0,0 +1,64 @@
+package sponge
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/xattr"
+)
+
+// CopyXattrs returns a MetadataFunc which copies the target's extended
+// attributes whose names begin with one of prefixes, like "user.".  No
+// prefixes copies them all.  Filesystems without extended attributes
+// have none to copy.
+func CopyXattrs(prefixes ...string) MetadataFunc {
+	return func(fn, targetFn string, target os.FileInfo) error {
+		if target == nil || fn == targetFn {
+			return nil
+		}
+		return copyXattrs(targetFn, fn, prefixes)
+	}
+}
+
+// Copies src's extended attributes beginning with one of prefixes to dest.
+func copyXattrs(src, dest string, prefixes []string) error {
+	names, err := xattr.List(src)
+	if err != nil {
+		if unsupported(err) {
+			return nil
+		}
+		return err
+	}
+	for _, name := range names {
+		if !hasAnyPrefix(name, prefixes) {
+			continue
+		}
+		value, err := xattr.Get(src, name)
+		if err != nil {
+			return err
+		}
+		if err := xattr.Set(dest, name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The target does not exist, or cannot have extended attributes.
+func unsupported(err error) bool {
+	return errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ENOTSUP) || errors.Is(err, xattr.ENOATTR)
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package sponge
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Rewrites a zip archive.  Other entries are copied as they are, still
+// compressed, with their metadata and the archive's comment.  A replaced
+// member keeps its header, apart from its size and modification time,
+// and its place in the archive.  New members are added at the end.
+func rewriteZip(w io.Writer, old *os.File, member string, data io.ReadSeeker, size int64) error {
+	zw := zip.NewWriter(w)
+	written := false
+	if old != nil {
+		fi, err := old.Stat()
+		if err != nil {
+			return err
+		}
+		zr, err := zip.NewReader(old, fi.Size())
+		if err != nil {
+			return err
+		}
+		if err := zw.SetComment(zr.Comment); err != nil {
+			return err
+		}
+		for _, f := range zr.File {
+			name := path.Clean(strings.TrimPrefix(f.Name, "/"))
+			if strings.HasPrefix(name, member+"/") || (name == member && f.Mode().IsDir()) {
+				return fmt.Errorf("%s is a directory in the archive.", member)
+			}
+			if name != member {
+				if err := zw.Copy(f); err != nil {
+					return err
+				}
+				continue
+			}
+			// Later copies of a member would override the new one.
+			if written {
+				continue
+			}
+			same, err := sameZipMember(f, data, size)
+			if err != nil {
+				return err
+			}
+			if same {
+				err = zw.Copy(f)
+			} else {
+				hdr := f.FileHeader
+				hdr.Modified = time.Now()
+				hdr.Extra = stripZipExtra(hdr.Extra)
+				err = writeZipMember(zw, &hdr, data, size)
+			}
+			if err != nil {
+				return err
+			}
+			written = true
+		}
+	}
+	if !written {
+		hdr := &zip.FileHeader{
+			Name:     member,
+			Method:   zip.Deflate,
+			Modified: time.Now(),
+		}
+		hdr.SetMode(DEFAULT_MODE)
+		if err := writeZipMember(zw, hdr, data, size); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// Reports whether the zip entry f already holds data.
+func sameZipMember(f *zip.File, data io.ReadSeeker, size int64) (bool, error) {
+	if f.UncompressedSize64 != uint64(size) {
+		return false, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+	if _, err := data.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	return SameContents(rc, data)
+}
+
+func writeZipMember(zw *zip.Writer, hdr *zip.FileHeader, data io.ReadSeeker, size int64) error {
+	if _, err := data.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	mw, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(mw, data, size)
+	return err
+}
+
+// Removes the extra fields which zip.Writer writes itself, the zip64
+// sizes and the extended timestamp, so that stale copies are not kept.
+func stripZipExtra(extra []byte) []byte {
+	kept := []byte{}
+	for len(extra) >= 4 {
+		tag := binary.LittleEndian.Uint16(extra)
+		n := 4 + int(binary.LittleEndian.Uint16(extra[2:]))
+		if n > len(extra) {
+			break
+		}
+		if tag != 0x0001 && tag != 0x5455 {
+			kept = append(kept, extra[:n]...)
+		}
+		extra = extra[n:]
+	}
+	return kept
+}
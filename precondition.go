@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+
+	"github.com/jmyounker/spunge/pkg/sponge"
+	"github.com/urfave/cli"
+)
+
+// CheckExpectedDigest checks the digest given by --expect-sha256.
+func CheckExpectedDigest(c *cli.Context) error {
+	if !c.GlobalIsSet("expect-sha256") {
+		return nil
+	}
+	digest, err := hex.DecodeString(c.GlobalString("expect-sha256"))
+	if err != nil || len(digest) != 32 {
+		return errors.New("--expect-sha256 must be 64 hex digits")
+	}
+	return nil
+}
+
+// GuardTarget sets the preconditions checked just before target is
+// replaced.  With --if-unmodified, target must not change until then,
+// and with --expect-sha256 it must have that digest.  For an archive
+// member these apply to the archive.  With --no-follow target must not be
+// reached through a symlink, now or then.  With --no-clobber it fails at
+// once if target exists, rather than after reading the input.  It also
+// names where --exchange keeps target's old contents, and where
+// --fallback-target saves the data if target's filesystem is read-only.
+func GuardTarget(c *cli.Context, target string, opts *sponge.Options) error {
+	fn := target
+	if archiveFn, _, ok := sponge.SplitMember(target); ok {
+		fn = archiveFn
+	}
+	if c.GlobalBool("no-follow") {
+		if err := CheckNoSymlinks(c, fn); err != nil {
+			return err
+		}
+		opts.Precondition = Preconditions(opts.Precondition, func() error {
+			return sponge.CheckNoSymlinks(fn)
+		})
+	}
+	if c.GlobalBool("no-clobber") {
+		if _, err := os.Lstat(fn); err == nil {
+			return &sponge.ModifiedError{Fn: fn, Detail: "already exists"}
+		}
+	}
+	if c.GlobalBool("if-unmodified") {
+		check, err := sponge.Unmodified(fn)
+		if err != nil {
+			return err
+		}
+		opts.Precondition = Preconditions(opts.Precondition, check)
+	}
+	if c.GlobalIsSet("expect-sha256") {
+		opts.Precondition = Preconditions(opts.Precondition, sponge.ExpectSHA256(fn, c.GlobalString("expect-sha256")))
+	}
+	if c.GlobalString("fallback-target") != "" {
+		fallbackFn, err := sponge.BackupFile(c.GlobalString("fallback-target"), target)
+		if err != nil {
+			return err
+		}
+		opts.FallbackFn = fallbackFn
+	}
+	if c.GlobalString("exchange") != "" {
+		oldFn, err := sponge.BackupFile(c.GlobalString("exchange"), target)
+		if err != nil {
+			return err
+		}
+		opts.ExchangeFn = oldFn
+	}
+	return nil
+}
+
+// Preconditions combines preconditions, skipping nil ones, into one which
+// checks them in order until one fails.
+func Preconditions(checks ...func() error) func() error {
+	active := []func() error{}
+	for _, check := range checks {
+		if check != nil {
+			active = append(active, check)
+		}
+	}
+	if len(active) == 0 {
+		return nil
+	}
+	return func() error {
+		for _, check := range active {
+			if err := check(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// CheckNoSymlinks checks that neither fn nor its temp directory is
+// reached through a symlink.
+func CheckNoSymlinks(c *cli.Context, fn string) error {
+	if err := sponge.CheckNoSymlinks(fn); err != nil {
+		return err
+	}
+	return sponge.CheckNoSymlinks(sponge.TempDir(c.GlobalString("tmpdir"), fn))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jmyounker/spunge/pkg/sponge"
+	"github.com/urfave/cli"
+)
+
+// Preservers are the kinds of metadata --preserve can carry over from
+// the replaced destination.
+var Preservers = map[string]func() sponge.MetadataFunc{
+	"xattr": func() sponge.MetadataFunc {
+		return sponge.CopyXattrs("user.")
+	},
+	"xattr-all": func() sponge.MetadataFunc {
+		return sponge.CopyXattrs()
+	},
+	"times": sponge.PreserveTimes,
+}
+
+// PreserverNames lists the choices for --preserve.
+func PreserverNames() string {
+	names := []string{}
+	for name := range Preservers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// GetPreserve returns the metadata requested with --preserve.
+func GetPreserve(c *cli.Context) ([]sponge.MetadataFunc, error) {
+	metadata := []sponge.MetadataFunc{}
+	if c.GlobalBool("preserve-times") {
+		metadata = append(metadata, sponge.PreserveTimes())
+	}
+	for _, list := range c.GlobalStringSlice("preserve") {
+		for _, name := range strings.Split(list, ",") {
+			preserver, ok := Preservers[strings.TrimSpace(name)]
+			if !ok {
+				return nil, fmt.Errorf("Cannot preserve %q, choose from %s.", name, PreserverNames())
+			}
+			metadata = append(metadata, preserver())
+		}
+	}
+	return metadata, nil
+}
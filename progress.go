@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ProgressInterval is how often progress is reported on a terminal, and
+// ProgressLogInterval how often otherwise.
+var ProgressInterval = 200 * time.Millisecond
+var ProgressLogInterval = 10 * time.Second
+
+// Progress counts the bytes read through it and reports them on stderr
+// until stopped.
+type Progress struct {
+	r     io.Reader
+	total int64
+	read  int64
+	start time.Time
+	tty   bool
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewProgress starts reporting progress reading r.  If total is positive
+// the report includes the percentage done and the time remaining.
+func NewProgress(r io.Reader, total int64) *Progress {
+	p := &Progress{r: r, total: total, start: time.Now(), stop: make(chan struct{})}
+	interval := ProgressLogInterval
+	if fi, err := os.Stderr.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		p.tty = true
+		interval = ProgressInterval
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.report(false)
+			case <-p.stop:
+				p.report(true)
+				return
+			}
+		}
+	}()
+	return p
+}
+
+func (p *Progress) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	atomic.AddInt64(&p.read, int64(n))
+	return n, err
+}
+
+// Stop prints the final report.
+func (p *Progress) Stop() {
+	close(p.stop)
+	p.wg.Wait()
+}
+
+// Prints one report, overwriting the last one on a terminal.
+func (p *Progress) report(final bool) {
+	line := p.String()
+	switch {
+	case p.tty && final:
+		fmt.Fprintf(os.Stderr, "\r%s\033[K\n", line)
+	case p.tty:
+		fmt.Fprintf(os.Stderr, "\r%s\033[K", line)
+	default:
+		fmt.Fprintln(os.Stderr, line)
+	}
+}
+
+// String summarizes the progress so far, like
+// "1.5G read, 120.0M/s, 75%, 0:04 left".
+func (p *Progress) String() string {
+	read := atomic.LoadInt64(&p.read)
+	elapsed := time.Since(p.start)
+	rate := int64(0)
+	if elapsed > 0 {
+		rate = int64(float64(read) / elapsed.Seconds())
+	}
+	s := fmt.Sprintf("%s read, %s/s", FormatSize(read), FormatSize(rate))
+	if p.total > 0 {
+		s += fmt.Sprintf(", %d%%", read*100/p.total)
+		if rate > 0 && read < p.total {
+			left := time.Duration(float64(p.total-read) / float64(rate) * float64(time.Second))
+			s += ", " + formatDuration(left) + " left"
+		}
+	}
+	return s
+}
+
+// Formats d as h:mm:ss or m:ss.
+func formatDuration(d time.Duration) string {
+	secs := int64(d.Round(time.Second) / time.Second)
+	if secs >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+	}
+	return fmt.Sprintf("%d:%02d", secs/60, secs%60)
+}
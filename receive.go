@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/urfave/cli"
+)
+
+func ServeHTTPAction(c *cli.Context) error {
+	if c.String("socket") != "" {
+		return errors.New("--http makes no sense with --socket")
+	}
+	if c.String("target") != "" {
+		return errors.New("--target makes no sense with --http")
+	}
+	if c.GlobalIsSet("framing") || c.GlobalIsSet("delimiter") {
+		return errors.New("--http takes one file per request, so it makes no sense with --framing or --delimiter")
+	}
+	if c.GlobalIsSet("expect-sha256") {
+		return errors.New("--expect-sha256 makes no sense with serve")
+	}
+	if err := CheckLock(c); err != nil {
+		return err
+	}
+	if err := SetRenameRetries(c); err != nil {
+		return err
+	}
+	if err := CheckParents(c); err != nil {
+		return err
+	}
+	root := c.String("root")
+	if root == "" {
+		return errors.New("Serving HTTP requires --root.")
+	}
+	fi, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory.", root)
+	}
+	if err := SetBufferSize(c, []string{root}); err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", c.String("http"))
+	if err != nil {
+		return err
+	}
+	ctx, _ := SignalContext(context.Background())
+	return ServeReceiver(ctx, c, ln, root)
+}
+
+// ServeReceiver installs uploads accepted by ln under root until ctx is
+// done.  Uploads in progress are then abandoned, leaving their
+// destinations untouched.
+func ServeReceiver(ctx context.Context, c *cli.Context, ln net.Listener, root string) error {
+	stopWatchdog := StartWatchdog()
+	defer stopWatchdog()
+	rcv := &Receiver{c: c, Root: root, addr: ln.Addr().String()}
+	srv := &http.Server{
+		Handler: rcv,
+		// Requests end with ctx, abandoning their uploads.
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		Notify("STOPPING=1")
+		srv.Shutdown(context.Background())
+	}()
+	Notify("READY=1", "STATUS=Listening on "+rcv.addr)
+	err := srv.Serve(ln)
+	if err != http.ErrServerClosed {
+		return err
+	}
+	<-stopped
+	return nil
+}
+
+// Receiver is an http.Handler which sponges the body of each PUT or POST
+// request, and then installs it under Root at the request's path.  An
+// upload replaces its destination only once the whole body has arrived.
+type Receiver struct {
+	Root      string
+	c         *cli.Context
+	addr      string
+	mu        sync.Mutex
+	busy      map[string]bool
+	committed int64
+}
+
+func (rcv *Receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "PUT, POST")
+		http.Error(w, "Only PUT and POST are supported.", http.StatusMethodNotAllowed)
+		return
+	}
+	target, err := ReceiverTarget(rcv.Root, r.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !rcv.claim(target) {
+		http.Error(w, "Another upload to this path is in progress.", http.StatusConflict)
+		return
+	}
+	defer rcv.release(target)
+	fi, err := os.Stat(target)
+	existed := err == nil
+	if existed && fi.IsDir() {
+		http.Error(w, "Destination is a directory.", http.StatusConflict)
+		return
+	}
+	if fi, err := os.Stat(filepath.Dir(target)); err != nil || !fi.IsDir() {
+		http.Error(w, "Destination's parent directory does not exist.", http.StatusConflict)
+		return
+	}
+	body := &requestBody{Reader: r.Body}
+	size, err := SpongeStream(r.Context(), rcv.c, body, target)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", target, err)
+		if body.err != nil {
+			http.Error(w, "Cannot read request body.", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), ReceiverStatus(err))
+		return
+	}
+	rcv.mu.Lock()
+	rcv.committed++
+	done := rcv.committed
+	rcv.mu.Unlock()
+	Notify(fmt.Sprintf("STATUS=Listening on %s, %d committed, last %s (%d bytes)", rcv.addr, done, target, size))
+	if existed {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Location", r.URL.Path)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Only one upload to each destination runs at a time.
+func (rcv *Receiver) claim(target string) bool {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	if rcv.busy[target] {
+		return false
+	}
+	if rcv.busy == nil {
+		rcv.busy = map[string]bool{}
+	}
+	rcv.busy[target] = true
+	return true
+}
+
+func (rcv *Receiver) release(target string) {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	delete(rcv.busy, target)
+}
+
+// requestBody remembers failures reading the request, which are the
+// client's fault rather than the server's.
+type requestBody struct {
+	io.Reader
+	err error
+}
+
+func (b *requestBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+// ReceiverTarget maps the request path urlPath onto a destination under
+// root.  Paths which climb out with .. or name a directory are refused.
+func ReceiverTarget(root, urlPath string) (string, error) {
+	if strings.HasSuffix(urlPath, "/") {
+		return "", errors.New("Destination must name a file.")
+	}
+	for _, elem := range strings.Split(urlPath, "/") {
+		if elem == ".." {
+			return "", errors.New("Destination must not contain '..'.")
+		}
+	}
+	p := path.Clean("/" + urlPath)
+	if p == "/" {
+		return "", errors.New("Destination must name a file.")
+	}
+	return filepath.Join(root, filepath.FromSlash(p)), nil
+}
+
+// ReceiverStatus chooses the HTTP status reporting a failed upload.
+func ReceiverStatus(err error) int {
+	switch {
+	case errors.Is(err, syscall.ENOSPC), errors.Is(err, syscall.EDQUOT):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable
+	case os.IsPermission(err):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
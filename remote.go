@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jmyounker/spunge/pkg/sponge"
+	"github.com/urfave/cli"
+)
+
+// localOnlyFlags make no sense for remote destinations, which have no
+// backups or file metadata, and are uploaded from a plain tempfile or
+// memory.
+var localOnlyFlags = []string{
+	"backup", "backup-numbered", "backup-dir", "backup-keep", "journal",
+	"atomic", "max-memory", "memfd", "mode", "reference", "owner", "group",
+	"preserve", "preserve-times", "append", "direct", "backend", "sparse",
+	"diff", "confirm", "skip-unchanged", "checksum", "lock", "lock-file",
+	"lock-dir", "lock-stale", "lock-timeout", "if-unmodified",
+	"expect-sha256", "no-clobber", "exchange", "in-place", "follow-symlinks",
+	"replace-symlink", "no-follow", "parents", "parents-mode",
+	"delete-if-empty", "rename-retries", "check-space",
+	"fallback-target",
+}
+
+// CheckRemoteTargets checks that any remote destinations are valid, and
+// that no options for local files are given with them.
+func CheckRemoteTargets(c *cli.Context, targets []string) error {
+	remote := false
+	for _, target := range targets {
+		if !sponge.IsRemote(target) {
+			continue
+		}
+		if _, err := sponge.NewUploader(target, sponge.Options{}); err != nil {
+			return err
+		}
+		remote = true
+	}
+	if !remote {
+		return nil
+	}
+	return RefuseFlags(c, localOnlyFlags, "a remote destination")
+}
+
+// RefuseFlags fails if any of the named flags are given, since they make
+// no sense with what.
+func RefuseFlags(c *cli.Context, names []string, what string) error {
+	for _, name := range names {
+		if c.GlobalIsSet(name) {
+			return fmt.Errorf("--%s makes no sense with %s", name, what)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jmyounker/spunge/pkg/sponge"
+	"github.com/urfave/cli"
+)
+
+// Report records what a run did, for --report-json.  Stage is where it
+// failed, or "done".
+type Report struct {
+	Outcome   string          `json:"outcome"`
+	Stage     string          `json:"stage"`
+	Error     string          `json:"error,omitempty"`
+	ExitCode  int             `json:"exit_code"`
+	Start     time.Time       `json:"start"`
+	Durations ReportDurations `json:"durations"`
+	BytesRead int64           `json:"bytes_read"`
+	Targets   []TargetReport  `json:"targets"`
+	committed bool
+}
+
+// ReportDurations are in seconds.
+type ReportDurations struct {
+	Transfer float64 `json:"transfer"`
+	Commit   float64 `json:"commit"`
+	Total    float64 `json:"total"`
+}
+
+// TargetReport records what happened to one destination.
+type TargetReport struct {
+	Target    string            `json:"target"`
+	Outcome   string            `json:"outcome"`
+	TempFile  string            `json:"temp_file,omitempty"`
+	Backup    string            `json:"backup,omitempty"`
+	Size      int64             `json:"size"`
+	Checksums map[string]string `json:"checksums,omitempty"`
+}
+
+// TimeoutMessage explains a run cut short by --timeout from the stage r
+// reached, since only the commit stage touches the destinations.
+func TimeoutMessage(c *cli.Context, r *Report) string {
+	what := "the destination was"
+	if len(Targets(c)) > 1 {
+		what = "the destinations were"
+	}
+	timeout := c.GlobalDuration("timeout")
+	switch r.Stage {
+	case "setup", "lock", "begin", "transfer":
+		return fmt.Sprintf("Timed out after %s, so %s left alone.", timeout, what)
+	case "backup":
+		return fmt.Sprintf("Timed out after %s while backing up, so %s left alone, though backups may have been made.", timeout, what)
+	case "delete":
+		return fmt.Sprintf("Timed out after %s while deleting, so some destinations may already be gone.", timeout)
+	}
+	return fmt.Sprintf("Timed out after %s while committing, so some destinations may already have been replaced.", timeout)
+}
+
+// Reporting reports whether anything will use the report, which costs a
+// little.
+func Reporting(c *cli.Context) bool {
+	return c.GlobalBool("stats") || c.GlobalIsSet("report-json") ||
+		c.GlobalBool("log-syslog") || c.GlobalIsSet("metrics-push")
+}
+
+// NewReport starts a report on a run beginning now.
+func NewReport() *Report {
+	return &Report{Start: time.Now(), Stage: "setup", Targets: []TargetReport{}}
+}
+
+// Describe records each destination.  Destinations which were committed
+// are hashed.
+func (r *Report) Describe(c *cli.Context, existed []bool, bf sponge.Backup, sf sponge.SpongeFile) {
+	backups := TargetBackups(bf, len(Targets(c)))
+	sponges := TargetSponges(sf)
+	r.Targets = []TargetReport{}
+	for i, target := range Targets(c) {
+		t := TargetReport{Target: target, Outcome: "failed", TempFile: sponge.ScratchFn(sponges[i])}
+		if cb, ok := backups[i].(*sponge.ConcurrentBackup); ok && existed[i] {
+			t.Backup = cb.BackupFn
+		}
+		if r.committed {
+			t.Outcome = "changed"
+			if !existed[i] {
+				t.Outcome = "created"
+			} else if ch, ok := sponges[i].(sponge.Changer); ok && !ch.Changed() {
+				t.Outcome = "unchanged"
+			}
+			t.Checksums = map[string]string{}
+			if sum, err := FileSHA256(target); err == nil {
+				t.Checksums["sha256"] = sum
+			}
+			if cs, ok := sponges[i].(*sponge.ChecksumSponge); ok {
+				t.Checksums[cs.Algorithm] = cs.Digest()
+			}
+		}
+		if fi, err := os.Stat(target); err == nil {
+			t.Size = fi.Size()
+		}
+		r.Targets = append(r.Targets, t)
+	}
+}
+
+// Finish records how the run ended.
+func (r *Report) Finish(err error) {
+	r.Durations.Total = time.Since(r.Start).Seconds()
+	if r.Outcome == "" {
+		r.Outcome = "committed"
+	}
+	if err == nil {
+		r.Stage = "done"
+		return
+	}
+	r.Error = err.Error()
+	r.ExitCode = 1
+	if ec, ok := err.(cli.ExitCoder); ok {
+		r.ExitCode = ec.ExitCode()
+	}
+	if r.ExitCode == ExitUnchanged {
+		r.Outcome = "unchanged"
+		r.Stage = "done"
+		r.Error = ""
+	} else if !r.committed {
+		r.Outcome = "failed"
+	}
+}
+
+// DescribeOutcome summarizes how the run ended in one line.
+func DescribeOutcome(r *Report) string {
+	if r.Error != "" {
+		return fmt.Sprintf("%s, %s failed: %s", r.Outcome, r.Stage, r.Error)
+	}
+	return r.Outcome
+}
+
+// WriteReport writes r as JSON to fn, or to stdout if fn is "-".
+func WriteReport(ctx context.Context, fn string, r *Report) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if fn == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	w, err := sponge.Create(ctx, fn, sponge.Options{})
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jmyounker/spunge/pkg/sponge"
+	"github.com/urfave/cli"
+)
+
+func RestoreAction(c *cli.Context) error {
+	if len(c.Args()) != 1 {
+		return errors.New("Restore requires exactly one destination.")
+	}
+	target := c.Args().First()
+	if BackupTemplate(c) == "" {
+		return errors.New("Restore needs the backup options used when writing, e.g. --backup.")
+	}
+	pattern, err := BackupPattern(c, target)
+	if err != nil {
+		return err
+	}
+	backups, err := sponge.FindBackups(pattern, target)
+	if err != nil {
+		return err
+	}
+	if c.Bool("list") {
+		for _, fn := range backups {
+			fmt.Println(fn)
+		}
+		return nil
+	}
+	if len(backups) == 0 {
+		return fmt.Errorf("No backups of %s match %s.", target, pattern)
+	}
+	ctx, caught := SignalContext(context.Background())
+	err = Restore(ctx, backups[0], target, GetOptions(c))
+	if sig := caught(); sig != nil {
+		return cli.NewExitError(fmt.Sprintf("Interrupted by %s.", sig), SignalExitCode(sig))
+	}
+	return err
+}
+
+// Restore atomically replaces target with a copy of backupFn, keeping
+// backupFn's mode.
+func Restore(ctx context.Context, backupFn, target string, opts sponge.Options) error {
+	in, err := os.Open(backupFn)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	opts.Append = false
+	opts.SkipUnchanged = false
+	opts.Verify = nil
+	opts.Mode = nil
+	sf := sponge.NewAtomicSponge(target, opts)
+	if err := sf.Begin(ctx); err != nil {
+		return err
+	}
+	defer sf.Cleanup()
+	if err := sponge.Transfer(ctx, in, sf); err != nil {
+		sf.Abort()
+		return err
+	}
+	if err := sf.Complete(ctx); err != nil {
+		return err
+	}
+	return os.Chmod(target, fi.Mode())
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/urfave/cli"
+)
+
+// SelectFiles returns the files chosen by each's --glob and --recursive,
+// less those ruled out by --include and --exclude.
+func SelectFiles(c *cli.Context) ([]string, error) {
+	patterns := append(append([]string{}, c.StringSlice("include")...), c.StringSlice("exclude")...)
+	for _, pattern := range append(patterns, c.StringSlice("glob")...) {
+		if !doublestar.ValidatePattern(filepath.ToSlash(pattern)) {
+			return nil, fmt.Errorf("Invalid pattern %q.", pattern)
+		}
+	}
+	selected := []string{}
+	for _, pattern := range c.StringSlice("glob") {
+		matches, err := doublestar.FilepathGlob(pattern, doublestar.WithFilesOnly(), doublestar.WithFailOnIOErrors())
+		if err != nil {
+			return nil, err
+		}
+		for _, fn := range matches {
+			if Selected(c, fn) {
+				selected = append(selected, fn)
+			}
+		}
+	}
+	for _, dir := range c.StringSlice("recursive") {
+		err := filepath.WalkDir(dir, func(fn string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(dir, fn)
+			if err != nil || rel == "." {
+				return err
+			}
+			if d.IsDir() {
+				if Excluded(c, rel) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Type().IsRegular() && Selected(c, rel) {
+				selected = append(selected, fn)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return selected, nil
+}
+
+// Selected reports whether the file fn passes --include and --exclude.
+func Selected(c *cli.Context, fn string) bool {
+	if Excluded(c, fn) {
+		return false
+	}
+	if len(c.StringSlice("include")) == 0 {
+		return true
+	}
+	for _, pattern := range c.StringSlice("include") {
+		if MatchPath(pattern, fn) {
+			return true
+		}
+	}
+	return false
+}
+
+// Excluded reports whether fn matches an --exclude pattern.
+func Excluded(c *cli.Context, fn string) bool {
+	for _, pattern := range c.StringSlice("exclude") {
+		if MatchPath(pattern, fn) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPath reports whether fn matches pattern.  Patterns without a slash
+// match the last element of fn, like find -name, and others match all of
+// it.
+func MatchPath(pattern, fn string) bool {
+	pattern, fn = filepath.ToSlash(pattern), filepath.ToSlash(fn)
+	if !strings.Contains(pattern, "/") {
+		fn = fn[strings.LastIndex(fn, "/")+1:]
+	}
+	return doublestar.MatchUnvalidated(pattern, fn)
+}
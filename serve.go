@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmyounker/spunge/pkg/sponge"
+	"github.com/urfave/cli"
+)
+
+func ServeAction(c *cli.Context) error {
+	if c.String("http") != "" {
+		return ServeHTTPAction(c)
+	}
+	if c.String("root") != "" {
+		return errors.New("--root makes no sense without --http")
+	}
+	socketFn := c.String("socket")
+	if socketFn == "" {
+		return errors.New("Serve requires --socket or --http.")
+	}
+	template := c.String("target")
+	if template == "" {
+		return errors.New("Serve requires --target.")
+	}
+	if err := CheckRecords(c); err != nil {
+		return err
+	}
+	if c.GlobalIsSet("delimiter") {
+		return errors.New("--delimiter makes no sense with serve")
+	}
+	if c.GlobalIsSet("expect-sha256") {
+		return errors.New("--expect-sha256 makes no sense with serve")
+	}
+	if err := CheckLock(c); err != nil {
+		return err
+	}
+	if err := SetRenameRetries(c); err != nil {
+		return err
+	}
+	if err := CheckParents(c); err != nil {
+		return err
+	}
+	target, err := ServeTarget(template, 0, 0, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := CheckRemoteTargets(c, []string{target}); err != nil {
+		return err
+	}
+	// Concurrent streams would each rewrite the archive, losing members.
+	if _, _, ok := sponge.SplitMember(target); ok && !sponge.IsRemote(target) {
+		return errors.New("Serve cannot write archive members.")
+	}
+	if target == sponge.StdoutTarget {
+		return errors.New("Serve cannot write to stdout.")
+	}
+	if err := SetBufferSize(c, []string{template}); err != nil {
+		return err
+	}
+	ln, err := ListenUnix(socketFn)
+	if err != nil {
+		return err
+	}
+	ctx, _ := SignalContext(context.Background())
+	// Being stopped by a signal is how a server normally ends.
+	return Serve(ctx, c, ln, template)
+}
+
+// ListenUnix listens on the Unix socket socketFn, replacing a stale
+// socket left behind by an earlier server.
+func ListenUnix(socketFn string) (net.Listener, error) {
+	if fi, err := os.Lstat(socketFn); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", socketFn); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("Another server is listening on %s.", socketFn)
+		}
+		if err := os.Remove(socketFn); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", socketFn)
+}
+
+// ServeTarget expands the destination template for the nth connection,
+// and with --framing its frame numbered record.
+func ServeTarget(template string, n, record int64, now time.Time) (string, error) {
+	return sponge.ExpandTemplate(template, map[string]string{
+		"{date}":   now.Format("20060102"),
+		"{time}":   now.Format("150405"),
+		"{conn}":   strconv.FormatInt(n, 10),
+		"{record}": strconv.FormatInt(record, 10),
+		"{pid}":    strconv.Itoa(os.Getpid()),
+	})
+}
+
+// Serve sponges each connection accepted by ln into its own destination
+// until ctx is done.  Connections in progress are then abandoned, leaving
+// their destinations untouched.
+func Serve(ctx context.Context, c *cli.Context, ln net.Listener, template string) error {
+	stopWatchdog := StartWatchdog()
+	defer stopWatchdog()
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	Notify("READY=1", "STATUS=Listening on "+ln.Addr().String())
+	var wg sync.WaitGroup
+	var conns, committed int64
+	var err error
+	for {
+		conn, aerr := ln.Accept()
+		if aerr != nil {
+			if ctx.Err() == nil {
+				err = aerr
+			}
+			break
+		}
+		n := atomic.AddInt64(&conns, 1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			if c.GlobalString("framing") != "" {
+				done := ServeFrames(ctx, c, conn, template, n)
+				atomic.AddInt64(&committed, done)
+				return
+			}
+			target, size, err := ServeConn(ctx, c, conn, template, n)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", target, err)
+				fmt.Fprintf(conn, "ERROR %s\n", err)
+				return
+			}
+			fmt.Fprintf(conn, "OK %s\n", target)
+			done := atomic.AddInt64(&committed, 1)
+			Notify(fmt.Sprintf("STATUS=Listening on %s, %d committed, last %s (%d bytes)", ln.Addr(), done, target, size))
+		}()
+	}
+	Notify("STOPPING=1")
+	wg.Wait()
+	return err
+}
+
+// ServeConn sponges conn until it closes, and then commits its data to
+// a destination named by template.  It returns the destination and how
+// much was written to it.
+func ServeConn(ctx context.Context, c *cli.Context, conn io.Reader, template string, n int64) (string, int64, error) {
+	target, err := ServeTarget(template, n, 1, time.Now())
+	if err != nil {
+		return "", 0, err
+	}
+	size, err := SpongeStream(ctx, c, conn, target)
+	return target, size, err
+}
+
+// ServeFrames commits each frame read from conn to its own destination,
+// named by template, answering OK DEST for each.  It stops at the first
+// failure, answering ERROR MESSAGE, and returns how many frames were
+// committed.
+func ServeFrames(ctx context.Context, c *cli.Context, conn net.Conn, template string, n int64) int64 {
+	src, stop := sponge.InterruptibleReader(ctx, conn)
+	defer stop()
+	frames, _ := OpenRecords(c, src)
+	for record := int64(1); ; record++ {
+		target, err := serveFrame(ctx, c, frames, template, n, record)
+		if err == io.EOF {
+			return record - 1
+		}
+		if err != nil {
+			if target == "" {
+				target = fmt.Sprintf("Connection %d", n)
+			}
+			fmt.Fprintf(os.Stderr, "%s: %s\n", target, err)
+			fmt.Fprintf(conn, "ERROR %s\n", err)
+			return record - 1
+		}
+		fmt.Fprintf(conn, "OK %s\n", target)
+	}
+}
+
+// Commits the next frame, returning its destination.
+func serveFrame(ctx context.Context, c *cli.Context, frames sponge.Records, template string, n, record int64) (string, error) {
+	frame, err := frames.Next()
+	if err != nil {
+		return "", err
+	}
+	target, err := ServeTarget(template, n, record, time.Now())
+	if err != nil {
+		return "", err
+	}
+	_, err = SpongeStream(ctx, c, frame, target)
+	return target, err
+}
+
+// SpongeStream sponges in until EOF, and then commits its data to
+// target.  It returns how much was read.
+func SpongeStream(ctx context.Context, c *cli.Context, in io.Reader, target string) (int64, error) {
+	if err := MakeParents(c, []string{target}); err != nil {
+		return 0, err
+	}
+	unlock, err := LockTargets(ctx, c, []string{target})
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	opts := GetOptions(c)
+	if err := GuardTarget(c, target, &opts); err != nil {
+		return 0, err
+	}
+	sf, err := GetStorageSponge(c, target, opts)
+	if err != nil {
+		return 0, err
+	}
+	sf, err = DecorateSponge(c, target, sf, opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := sf.Begin(ctx); err != nil {
+		return 0, err
+	}
+	defer sf.Cleanup()
+	counted := &CountingReader{Reader: in}
+	if err := sponge.Transfer(ctx, counted, sf); err != nil {
+		sf.Abort()
+		return counted.N, err
+	}
+	if err := sf.Complete(ctx); err != nil {
+		return counted.N, err
+	}
+	return counted.N, nil
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package main
+
+import (
+	"strings"
+)
+
+// Shell runs command templates.
+var Shell = []string{"/bin/sh", "-c"}
+
+// ShellQuote quotes s for use as a single /bin/sh word.
+func ShellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,10 @@
+package main
+
+// Shell runs command templates.
+var Shell = []string{"cmd.exe", "/C"}
+
+// ShellQuote quotes s for use as a single cmd.exe word.  Windows
+// filenames cannot contain double quotes.
+func ShellQuote(s string) string {
+	return `"` + s + `"`
+}
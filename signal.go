@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// Signals which interrupt a sponge.
+var interruptSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// SignalContext returns a context which is cancelled when the process
+// receives SIGINT or SIGTERM, and a function reporting which signal
+// arrived.  After the first signal the default handling is restored, so
+// a second one terminates immediately.
+func SignalContext(parent context.Context) (context.Context, func() os.Signal) {
+	ctx, cancel := context.WithCancel(parent)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, interruptSignals...)
+	var mu sync.Mutex
+	var caught os.Signal
+	go func() {
+		select {
+		case sig := <-sigs:
+			mu.Lock()
+			caught = sig
+			mu.Unlock()
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigs)
+	}()
+	return ctx, func() os.Signal {
+		mu.Lock()
+		defer mu.Unlock()
+		return caught
+	}
+}
+
+// SignalExitCode follows the shell convention of 128 plus the signal
+// number.
+func SignalExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+var sizeSuffixes = []struct {
+	suffix string
+	scale  int64
+}{
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"T", 1 << 40},
+}
+
+// ParseSize parses a byte count such as 4096, 64K, or 1.5G.  Suffixes
+// are binary multiples and may be followed by an optional "B".
+func ParseSize(s string) (int64, error) {
+	num := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	scale := int64(1)
+	for _, ss := range sizeSuffixes {
+		if strings.HasSuffix(num, ss.suffix) {
+			num = strings.TrimSuffix(num, ss.suffix)
+			scale = ss.scale
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("Invalid size %q.", s)
+	}
+	return int64(n * float64(scale)), nil
+}
+
+// FormatSize formats a byte count briefly, like 4096, 64K, or 1.5G.
+func FormatSize(n int64) string {
+	for i := len(sizeSuffixes) - 1; i >= 0; i-- {
+		ss := sizeSuffixes[i]
+		if n >= ss.scale {
+			return strconv.FormatFloat(float64(n)/float64(ss.scale), 'f', 1, 64) + ss.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// SizeLimits returns the sizes given by --min-bytes and --max-bytes.
+// Without --max-bytes the maximum is zero, which is unlimited.
+func SizeLimits(c *cli.Context) (int64, int64, error) {
+	var min, max int64
+	var err error
+	if c.GlobalIsSet("min-bytes") {
+		if min, err = ParseSize(c.GlobalString("min-bytes")); err != nil {
+			return 0, 0, err
+		}
+	}
+	if c.GlobalIsSet("max-bytes") {
+		if max, err = ParseSize(c.GlobalString("max-bytes")); err != nil {
+			return 0, 0, err
+		}
+		if max <= 0 {
+			return 0, 0, errors.New("--max-bytes must be positive")
+		}
+	}
+	return min, max, nil
+}
+
+// CheckSizeLimits checks the sizes given by --min-bytes and --max-bytes.
+func CheckSizeLimits(c *cli.Context) error {
+	min, max, err := SizeLimits(c)
+	if err != nil {
+		return err
+	}
+	if max > 0 && min > max {
+		return errors.New("--min-bytes must not be more than --max-bytes")
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jmyounker/spunge/pkg/sponge"
+	"github.com/urfave/cli"
+)
+
+// CountingReader counts the bytes read through it.
+type CountingReader struct {
+	io.Reader
+	N int64
+}
+
+func (cr *CountingReader) Read(p []byte) (int, error) {
+	n, err := cr.Reader.Read(p)
+	cr.N += int64(n)
+	return n, err
+}
+
+// PrintStats summarizes a completed run on stderr, one line per
+// destination.
+func PrintStats(c *cli.Context, read int64, elapsed time.Duration, existed []bool, bf sponge.Backup, sf sponge.SpongeFile) {
+	backups := TargetBackups(bf, len(Targets(c)))
+	sponges := TargetSponges(sf)
+	for i, target := range Targets(c) {
+		fmt.Fprintln(os.Stderr, DescribeStats(target, read, elapsed, existed[i], backups[i], sponges[i]))
+	}
+}
+
+// DescribeStats summarizes a run for one destination, like
+// "f: changed, 1.5M in 1.2s (1.3M/s), backup f.bak (1.0M)".
+func DescribeStats(target string, read int64, elapsed time.Duration, existed bool, bf sponge.Backup, sf sponge.SpongeFile) string {
+	outcome := "changed"
+	if !existed {
+		outcome = "created"
+	} else if ch, ok := sf.(sponge.Changer); ok && !ch.Changed() {
+		outcome = "unchanged"
+	}
+	rate := int64(0)
+	if elapsed > 0 {
+		rate = int64(float64(read) / elapsed.Seconds())
+	}
+	s := fmt.Sprintf("%s: %s, %s in %s (%s/s)", target, outcome, FormatSize(read), elapsed.Round(time.Millisecond), FormatSize(rate))
+	if cb, ok := bf.(*sponge.ConcurrentBackup); ok && existed {
+		if fi, err := os.Stat(cb.BackupFn); err == nil {
+			s += fmt.Sprintf(", backup %s (%s)", cb.BackupFn, FormatSize(fi.Size()))
+		}
+	}
+	return s
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/jmyounker/spunge/pkg/sponge"
+	"github.com/urfave/cli"
+)
+
+// CheckStdoutTarget checks that no options for files are given when a
+// destination is stdout, and that nothing else writes there too.
+func CheckStdoutTarget(c *cli.Context, targets []string) error {
+	found := false
+	for _, target := range targets {
+		if target != sponge.StdoutTarget {
+			continue
+		}
+		if found {
+			return errors.New("The destination - may only be given once.")
+		}
+		found = true
+	}
+	if !found {
+		return nil
+	}
+	if c.GlobalString("report-json") == "-" {
+		return errors.New("--report-json - makes no sense with the destination -")
+	}
+	return RefuseFlags(c, append([]string{"tee"}, localOnlyFlags...), "the destination -")
+}
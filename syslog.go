@@ -0,0 +1,12 @@
+//go:build !windows
+
+package main
+
+import (
+	"log/syslog"
+)
+
+// OpenSyslog connects to the system log.
+func OpenSyslog() (SystemLog, error) {
+	return syslog.New(syslog.LOG_USER|syslog.LOG_INFO, "spunge")
+}
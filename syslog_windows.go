@@ -0,0 +1,10 @@
+package main
+
+import (
+	"errors"
+)
+
+// OpenSyslog fails, since Windows has no syslog.
+func OpenSyslog() (SystemLog, error) {
+	return nil, errors.New("Cannot log to syslog on Windows.")
+}
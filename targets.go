@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/jmyounker/spunge/pkg/sponge"
+	"github.com/urfave/cli"
+)
+
+// resolvedTargets holds the destinations once ResolveTargets has named
+// the files going into directory destinations.
+var resolvedTargets []string
+
+// Targets returns the destinations, with directories replaced by the
+// files to write in them.
+func Targets(c *cli.Context) []string {
+	if resolvedTargets == nil {
+		return c.Args()
+	}
+	return resolvedTargets
+}
+
+// ResolveTargets replaces each destination which is a directory, or ends
+// with a separator, by a file within it named by --name or after the
+// input.
+func ResolveTargets(c *cli.Context) error {
+	name := c.GlobalString("name")
+	if name != "" && (name == "." || name == ".." || strings.ContainsAny(name, `/\`)) {
+		return fmt.Errorf("Invalid --name %q, which must be a plain filename.", name)
+	}
+	targets := []string{}
+	named := false
+	for _, target := range c.Args() {
+		if !IsDirTarget(target) {
+			targets = append(targets, target)
+			continue
+		}
+		if name == "" {
+			var err error
+			if name, err = InputName(c); err != nil {
+				return fmt.Errorf("Cannot name a file in the directory %s: %s", target, err)
+			}
+		}
+		targets = append(targets, filepath.Join(target, name))
+		named = true
+	}
+	if c.GlobalIsSet("name") && !named {
+		return errors.New("--name makes no sense without a directory destination")
+	}
+	resolvedTargets = targets
+	return nil
+}
+
+// IsDirTarget reports whether target names a local directory, rather than
+// a file.
+func IsDirTarget(target string) bool {
+	if sponge.IsRemote(target) || target == sponge.StdoutTarget {
+		return false
+	}
+	if _, _, ok := sponge.SplitMember(target); ok {
+		return false
+	}
+	if strings.HasSuffix(target, "/") || strings.HasSuffix(target, string(filepath.Separator)) {
+		return true
+	}
+	fi, err := os.Stat(target)
+	return err == nil && fi.IsDir()
+}
+
+// InputName returns the name of the single input file, or of the last
+// part of its URL.
+func InputName(c *cli.Context) (string, error) {
+	inputs := c.GlobalStringSlice("input")
+	if len(inputs) != 1 || inputs[0] == "-" {
+		return "", errors.New("give --name, or a single --input to name it after.")
+	}
+	name := filepath.Base(inputs[0])
+	if u, err := url.Parse(inputs[0]); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		name = path.Base(u.Path)
+	}
+	if name == "." || name == "/" || name == "" {
+		return "", fmt.Errorf("%s has no filename, so give --name.", inputs[0])
+	}
+	return name, nil
+}
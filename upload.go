@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jmyounker/spunge/pkg/sponge"
+	"github.com/urfave/cli"
+)
+
+// streamConflicts make no sense when the data goes to a stream, such as
+// an open descriptor or a command, which has no name to back up, rename
+// over, or give metadata to.
+var streamConflicts = []string{
+	"cas", "exec", "backup", "backup-numbered", "backup-dir", "backup-keep",
+	"journal", "atomic", "max-memory", "memfd", "mode", "reference", "owner",
+	"group", "preserve", "preserve-times", "append", "direct", "backend",
+	"sparse", "dry-run", "diff", "confirm", "skip-unchanged", "checksum",
+	"post-cmd", "lock", "lock-file", "lock-dir",
+	"lock-stale", "lock-timeout", "if-unmodified", "expect-sha256",
+	"no-clobber", "exchange", "in-place", "follow-symlinks",
+	"replace-symlink", "no-follow", "parents", "parents-mode",
+	"delete-if-empty", "rename-retries", "check-space",
+	"fallback-target",
+}
+
+// SpongeOutputFD writes the input over the descriptor given by
+// --output-fd once it is complete.
+func SpongeOutputFD(ctx context.Context, c *cli.Context, r *Report) error {
+	fd := c.GlobalInt("output-fd")
+	if len(c.Args()) > 0 {
+		return errors.New("--output-fd names the destination, so it makes no sense with DEST")
+	}
+	if err := RefuseFlags(c, append([]string{"exec-output"}, streamConflicts...), "--output-fd"); err != nil {
+		return err
+	}
+	if fd < 0 {
+		return errors.New("--output-fd must not be negative")
+	}
+	name := fmt.Sprintf("fd %d", fd)
+	out := os.NewFile(uintptr(fd), name)
+	if _, err := out.Stat(); err != nil {
+		return fmt.Errorf("Cannot write to descriptor %d: %s", fd, err)
+	}
+	return SpongeUpload(ctx, c, r, name, sponge.FileUploader{File: out})
+}
+
+// SpongeExecOutput starts the command given by --exec-output once the
+// input is complete, and writes the input to its stdin.
+func SpongeExecOutput(ctx context.Context, c *cli.Context, r *Report) error {
+	if len(c.Args()) > 0 {
+		return errors.New("--exec-output names the destination, so it makes no sense with DEST")
+	}
+	if err := RefuseFlags(c, append([]string{"tee"}, streamConflicts...), "--exec-output"); err != nil {
+		return err
+	}
+	script := c.GlobalString("exec-output")
+	return SpongeUpload(ctx, c, r, script, commandUploader{script})
+}
+
+// SpongeUpload collects the input in a tempfile or memory, and then
+// hands it to up.
+func SpongeUpload(ctx context.Context, c *cli.Context, r *Report, name string, up sponge.Uploader) error {
+	if err := SetBufferSize(c, nil); err != nil {
+		return err
+	}
+	opts := GetOptions(c)
+	sf, err := DecorateSponge(c, name, sponge.NewRemoteSponge(name, up, c.GlobalBool("memory"), opts), opts)
+	if err != nil {
+		return err
+	}
+	replay, isReplayer := sf.(sponge.Replayer)
+	if c.GlobalBool("tee") && !isReplayer {
+		return errors.New("--tee is not supported by this destination")
+	}
+	in, err := OpenInput(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r.Stage = "begin"
+	if err := sf.Begin(ctx); err != nil {
+		return err
+	}
+	defer sf.Cleanup()
+	r.Stage = "transfer"
+	Notify("READY=1", "STATUS=Reading input for "+name)
+	if err := TransferInput(ctx, c, in, sf); err != nil {
+		sf.Abort()
+		return err
+	}
+	r.Stage = "commit"
+	if err := sf.Complete(ctx); err != nil {
+		return err
+	}
+	r.committed = true
+	if c.GlobalBool("tee") {
+		r.Stage = "finish"
+		return replay.Replay(os.Stdout)
+	}
+	return nil
+}
+
+// commandUploader runs a shell command with the data on its stdin.  The
+// command's output goes to stdout.
+type commandUploader struct {
+	script string
+}
+
+func (cu commandUploader) Upload(ctx context.Context, r io.ReadSeeker, size int64) error {
+	cmd := FilterCommand(ctx, cu.script)
+	cmd.Stdin = r
+	cmd.Stdout = os.Stdout
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Output command failed: %s", err)
+	}
+	return nil
+}